@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/babourine/x/pkg/process"
 
@@ -13,34 +17,74 @@ import (
 
 var (
 	configFile string
+	resume     bool
+
+	// subcommands, named by the first argument; without one the pipeline is run
+	commands = map[string]func(args []string) int{
+		`graph`:    graph,
+		`test`:     test,
+		`validate`: validate,
+	}
 )
 
 func init() {
 
 	flag.StringVar(&configFile, `conf`, ``, `config file`)
-	flag.Parse()
-
-	if configFile == `` {
-		executableName, err := os.Executable()
-		if err != nil {
-			process.Bail(`executable`, err)
-		}
-		process.Bail(`usage`, fmt.Errorf("%s -conf <pipeline configuration>", executableName))
-	}
+	flag.BoolVar(&resume, `resume`, false, `skip source units completed by an earlier run, as recorded by the pipeline checkpoint`)
 
 }
 
 func main() {
 
+	if len(os.Args) > 1 {
+		if command, found := commands[os.Args[1]]; found {
+			os.Exit(command(os.Args[2:]))
+		}
+	}
+
+	flag.Parse()
+	if configFile == `` {
+		usage(`-conf <pipeline configuration>`)
+	}
+
 	p := &pipeline.Pipeline{}
 
 	// load pipeline configuration
 	if err := config.Load(configFile, p); err != nil {
 		process.Bail(`config`, err)
 	}
+	if resume {
+		if p.Checkpoint == nil {
+			process.Bail(`config`, fmt.Errorf("-resume requires a checkpoint in the pipeline configuration"))
+		}
+		p.Checkpoint.Resume = true
+	}
+	// logs outside of any task, e.g. from jq functions, follow log_level and log_format too
+	slog.SetDefault(p.Logger())
+
+	// SIGINT/SIGTERM stop the sources and let in-flight records drain; a second
+	// signal falls back to the default behaviour and terminates immediately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
 	// run pipeline
-	if err := p.Run(); err != nil {
+	if err := p.Run(ctx); err != nil {
 		process.Bail(`pipeline`, err)
 	}
 
 }
+
+// usage exits with the arguments a command expects
+func usage(arguments string) {
+
+	executableName, err := os.Executable()
+	if err != nil {
+		process.Bail(`executable`, err)
+	}
+	process.Bail(`usage`, fmt.Errorf("%s %s", executableName, arguments))
+
+}
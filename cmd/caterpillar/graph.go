@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/patterninc/caterpillar/internal/pkg/config"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline"
+)
+
+// graph prints the topology of a pipeline, as resolved from its dag or its tasks
+// in order, without running it or contacting external services
+func graph(args []string) int {
+
+	flags := flag.NewFlagSet(`graph`, flag.ExitOnError)
+	configFile := flags.String(`conf`, ``, `config file`)
+	format := flags.String(`format`, `dot`, `output format: dot, mermaid or json`)
+	flags.Parse(args)
+
+	if *configFile == `` {
+		usage(`graph -conf <pipeline configuration> [-format dot|mermaid|json]`)
+	}
+
+	content, err := config.Render(*configFile, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *configFile, err)
+		return 1
+	}
+
+	p, problems := pipeline.Decode(content)
+	if len(problems) > 0 {
+		printProblems(*configFile, problems)
+		return 1
+	}
+
+	g := p.Graph()
+	switch *format {
+	case `dot`:
+		fmt.Print(g.DOT())
+	case `mermaid`:
+		fmt.Print(g.Mermaid())
+	case `json`:
+		data, err := json.MarshalIndent(g, ``, `  `)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *configFile, err)
+			return 1
+		}
+		fmt.Println(string(data))
+	default:
+		fmt.Fprintf(os.Stderr, "unsupported format %s, expected dot, mermaid or json\n", *format)
+		return 2
+	}
+
+	return 0
+
+}
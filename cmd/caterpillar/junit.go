@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// JUnit XML report of caterpillar test, as read by CI systems
+type junitSuite struct {
+	XMLName  xml.Name     `xml:"testsuite"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Time     string       `xml:"time,attr"`
+	Cases    []*junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+func writeJUnit(file string, results []*testResult) error {
+
+	suite := &junitSuite{Name: `caterpillar`, Tests: len(results)}
+
+	var total time.Duration
+	for _, result := range results {
+		total += result.duration
+		c := &junitCase{
+			Name:      result.file,
+			ClassName: `caterpillar`,
+			Time:      seconds(result.duration),
+			SystemOut: result.output,
+		}
+		switch {
+		case result.skipped:
+			suite.Skipped++
+			c.Skipped = &junitSkipped{Message: `no expect section`}
+		case len(result.failures) > 0:
+			suite.Failures++
+			c.Failure = &junitFailure{
+				Message: fmt.Sprintf("%d expectations failed", len(result.failures)),
+				Text:    strings.Join(result.failures, "\n"),
+			}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	suite.Time = seconds(total)
+
+	data, err := xml.MarshalIndent(suite, ``, `  `)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, append([]byte(xml.Header), append(data, '\n')...), 0o644)
+
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/patterninc/caterpillar/internal/pkg/config"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline"
+)
+
+const (
+	testSuffix = `_test.yaml`
+)
+
+// testResult is the outcome of one test pipeline; a pipeline without expectations is skipped
+type testResult struct {
+	file     string
+	failures []string
+	skipped  bool
+	duration time.Duration
+	output   string // what the pipeline printed while it ran
+}
+
+// test runs the *_test.yaml pipelines found in the given files and directories
+// and checks the records reaching their end against their expect section
+func test(args []string) int {
+
+	flags := flag.NewFlagSet(`test`, flag.ExitOnError)
+	verbose := flags.Bool(`v`, false, `print the output of every pipeline, not only of those that fail`)
+	timeout := flags.Duration(`timeout`, time.Minute, `time a pipeline may run before it is stopped`)
+	junit := flags.String(`junit`, ``, `write a JUnit XML report to this file`)
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		usage(`test [-v] [-timeout <duration>] [-junit <report file>] <pipeline files or directories>`)
+	}
+
+	files, err := testFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var results []*testResult
+	failed := 0
+	for _, file := range files {
+		result := runTest(file, *timeout)
+		results = append(results, result)
+
+		switch {
+		case result.skipped:
+			fmt.Printf("SKIP %s (no expect section)\n", file)
+		case len(result.failures) > 0:
+			failed++
+			fmt.Printf("FAIL %s (%.2fs)\n", file, result.duration.Seconds())
+			for _, failure := range result.failures {
+				fmt.Println(indent(failure))
+			}
+		default:
+			fmt.Printf("PASS %s (%.2fs)\n", file, result.duration.Seconds())
+		}
+		if result.output != `` && (*verbose || len(result.failures) > 0) {
+			fmt.Println(indent(strings.TrimRight(result.output, "\n")))
+		}
+	}
+
+	fmt.Printf("%d passed, %d failed, %d skipped\n", len(results)-failed-skipped(results), failed, skipped(results))
+
+	if *junit != `` {
+		if err := writeJUnit(*junit, results); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	if failed > 0 {
+		return 1
+	}
+
+	return 0
+
+}
+
+// testFiles returns the files given, and the *_test.yaml files in the directories given
+func testFiles(paths []string) ([]string, error) {
+
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() && strings.HasSuffix(file, testSuffix) {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+
+}
+
+// runTest runs a test pipeline with what it prints captured, so the report stays readable
+func runTest(file string, timeout time.Duration) *testResult {
+
+	result := &testResult{file: file}
+
+	// pipelines without expectations may need services that are not there, so
+	// they are not loaded at all
+	content, err := config.Render(file, true)
+	if err != nil {
+		result.failures = []string{err.Error()}
+		return result
+	}
+	var sections struct {
+		Expect *yaml.Node `yaml:"expect"`
+	}
+	if err := yaml.Unmarshal(content, &sections); err != nil {
+		result.failures = []string{err.Error()}
+		return result
+	}
+	if sections.Expect == nil {
+		result.skipped = true
+		return result
+	}
+
+	start := time.Now()
+	result.output, result.failures = captureOutput(func() []string {
+
+		// the logger of the pipeline is created as it loads
+		p := &pipeline.Pipeline{}
+		if err := config.Load(file, p); err != nil {
+			return []string{err.Error()}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		failures := p.Test(ctx)
+		if ctx.Err() != nil {
+			failures = append([]string{fmt.Sprintf("the run was stopped after %s", timeout)}, failures...)
+		}
+
+		return failures
+
+	})
+	result.duration = time.Since(start)
+
+	return result
+
+}
+
+// captureOutput runs f with stdout and stderr written to the returned output
+func captureOutput(f func() []string) (string, []string) {
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return ``, f()
+	}
+
+	var output bytes.Buffer
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(&output, reader)
+		close(copied)
+	}()
+
+	// the log package keeps the stderr it started with
+	stdout, stderr, logs := os.Stdout, os.Stderr, log.Writer()
+	os.Stdout, os.Stderr = writer, writer
+	log.SetOutput(writer)
+	failures := f()
+	os.Stdout, os.Stderr = stdout, stderr
+	log.SetOutput(logs)
+
+	writer.Close()
+	<-copied
+	reader.Close()
+
+	return output.String(), failures
+
+}
+
+func skipped(results []*testResult) int {
+	count := 0
+	for _, result := range results {
+		if result.skipped {
+			count++
+		}
+	}
+	return count
+}
+
+func indent(text string) string {
+	return `    ` + strings.ReplaceAll(text, "\n", "\n    ")
+}
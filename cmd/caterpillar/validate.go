@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/patterninc/caterpillar/internal/pkg/config"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline"
+)
+
+// validate checks a pipeline configuration without running it or contacting
+// external services, and prints every problem found with its line
+func validate(args []string) int {
+
+	flags := flag.NewFlagSet(`validate`, flag.ExitOnError)
+	configFile := flags.String(`conf`, ``, `config file`)
+	flags.Parse(args)
+
+	if *configFile == `` {
+		usage(`validate -conf <pipeline configuration>`)
+	}
+
+	content, err := config.Render(*configFile, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *configFile, err)
+		return 1
+	}
+
+	if problems := pipeline.Validate(content); len(problems) > 0 {
+		printProblems(*configFile, problems)
+		return 1
+	}
+
+	fmt.Printf("%s: ok\n", *configFile)
+	return 0
+
+}
+
+// printProblems prints the problems found in a configuration file to stderr
+func printProblems(configFile string, problems []pipeline.Problem) {
+	for _, problem := range problems {
+		if problem.Line > 0 {
+			fmt.Fprintf(os.Stderr, "%s:%d: %s\n", configFile, problem.Line, problem.Message)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", configFile, problem.Message)
+		}
+	}
+}
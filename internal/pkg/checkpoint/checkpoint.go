@@ -0,0 +1,454 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patterninc/caterpillar/internal/pkg/duration"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+)
+
+const (
+	defaultRegion       = `us-west-2`
+	defaultSaveInterval = duration.Duration(10 * time.Second)
+	s3Prefix            = `s3://`
+	batchSeparator      = `#`
+)
+
+// Checkpoint records the source units (files, pages) each task has finished, so
+// a run started again with resume set skips them instead of starting over.
+//
+// The records a task sends for a unit are tracked through the pipeline, along with
+// the records made from them, and the unit is recorded once all of them have been
+// handled by the tasks downstream, sinks included. Recorded units are saved every
+// save_interval and when the run ends.
+type Checkpoint struct {
+	Path         string            `yaml:"path,omitempty" json:"path,omitempty"`
+	Region       string            `yaml:"region,omitempty" json:"region,omitempty"`
+	Resume       bool              `yaml:"resume,omitempty" json:"resume,omitempty"`
+	SaveInterval duration.Duration `yaml:"save_interval,omitempty" json:"save_interval,omitempty"`
+
+	store    store
+	state    *state
+	done     map[string]map[string]bool
+	batches  map[string]*batches // units completed by each task, waiting on their records
+	inFlight map[string]int      // records not handled yet, by batch
+	dirty    bool                // units were recorded since the last save
+	logger   *slog.Logger
+	stop     chan struct{}
+	stopped  chan struct{}
+	sync.Mutex
+}
+
+// state is what gets persisted: the completed units of every task, in order
+type state struct {
+	Tasks map[string][]string `json:"tasks"`
+}
+
+// batches are the records a task sent between two units it completed: the batch
+// open takes the records sent until the next unit is completed
+type batches struct {
+	open   int
+	closed []*batch // in the order the task completed them
+}
+
+// batch is a unit completed by a task, recorded once its records are handled
+type batch struct {
+	key     string
+	unit    string
+	replace bool // the unit replaces the ones before it
+}
+
+type store interface {
+	load(context.Context) ([]byte, error) // nil data when nothing was saved yet
+	save(context.Context, []byte) error
+}
+
+// Init validates the configuration; it is called once after unmarshaling
+func (c *Checkpoint) Init() error {
+
+	if c.Path == `` {
+		return fmt.Errorf("checkpoint path is required")
+	}
+	if c.Region == `` {
+		c.Region = defaultRegion
+	}
+	if c.SaveInterval == 0 {
+		c.SaveInterval = defaultSaveInterval
+	}
+	if c.SaveInterval < 0 {
+		return fmt.Errorf("checkpoint save_interval must be positive")
+	}
+
+	if strings.HasPrefix(c.Path, s3Prefix) {
+		c.store = &s3Store{path: c.Path, region: c.Region}
+	} else {
+		c.store = &localStore{path: c.Path}
+	}
+
+	return nil
+
+}
+
+// Open loads the units completed by an earlier run when resuming; otherwise the
+// run starts from scratch and replaces the checkpoint as it goes. Units recorded
+// are saved every save_interval until Close.
+func (c *Checkpoint) Open(ctx context.Context, logger *slog.Logger) error {
+
+	if c == nil {
+		return nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.state = &state{Tasks: make(map[string][]string)}
+	c.done = make(map[string]map[string]bool)
+	c.batches = make(map[string]*batches)
+	c.inFlight = make(map[string]int)
+	c.dirty = false
+	c.logger = logger
+
+	if c.Resume {
+		data, err := c.store.load(ctx)
+		if err != nil {
+			return fmt.Errorf("cannot load checkpoint %s: %w", c.Path, err)
+		}
+		if data != nil {
+			if err := json.Unmarshal(data, c.state); err != nil {
+				return fmt.Errorf("cannot parse checkpoint %s: %w", c.Path, err)
+			}
+		}
+		if c.state.Tasks == nil {
+			c.state.Tasks = make(map[string][]string)
+		}
+		for name, units := range c.state.Tasks {
+			c.done[name] = make(map[string]bool, len(units))
+			for _, unit := range units {
+				c.done[name][unit] = true
+			}
+		}
+	}
+
+	c.stop, c.stopped = make(chan struct{}), make(chan struct{})
+	go c.saveEvery(time.Duration(c.SaveInterval))
+
+	return nil
+
+}
+
+// Close stops saving periodically and saves the units recorded since the last save
+func (c *Checkpoint) Close() error {
+
+	if c == nil || c.stop == nil {
+		return nil
+	}
+
+	close(c.stop)
+	<-c.stopped
+	c.stop = nil
+
+	return c.save()
+
+}
+
+// CommitAll records every unit completed, whether or not its records were seen
+// handled; call it once the run has ended without losing any record, for the
+// records of tasks reading ahead of what they handle
+func (c *Checkpoint) CommitAll() {
+
+	if c == nil || c.state == nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	for name, b := range c.batches {
+		for _, completed := range b.closed {
+			c.record(name, completed)
+		}
+		b.closed = nil
+	}
+
+}
+
+// Forked counts the copies of r made when a record is sent to more than one branch
+func (c *Checkpoint) Forked(r *record.Record, copies int) {
+
+	key, found := batchKey(r)
+	if c == nil || !found || copies <= 0 {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.inFlight[key] += copies
+
+}
+
+// Dropped tells that r was dropped by the pipeline, e.g. routed to no branch
+func (c *Checkpoint) Dropped(r *record.Record) {
+
+	if key, found := batchKey(r); c != nil && found {
+		c.handled(key)
+	}
+
+}
+
+// Task returns the checkpoint of the named task
+func (c *Checkpoint) Task(name string) *Task {
+	return &Task{
+		name:       name,
+		checkpoint: c,
+		current:    make(map[<-chan *record.Record]string),
+	}
+}
+
+func (c *Checkpoint) isDone(name, unit string) bool {
+
+	c.Lock()
+	defer c.Unlock()
+
+	return c.done[name][unit]
+
+}
+
+func (c *Checkpoint) last(name string) (string, bool) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	units := c.state.Tasks[name]
+	if len(units) == 0 {
+		return ``, false
+	}
+
+	return units[len(units)-1], true
+
+}
+
+// complete closes the open batch of the task with unit, which is recorded once
+// the records of the batch, and those of the batches before it, are handled
+func (c *Checkpoint) complete(name, unit string, replace bool) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	b := c.taskBatches(name)
+	b.closed = append(b.closed, &batch{
+		key:     name + batchSeparator + strconv.Itoa(b.open),
+		unit:    unit,
+		replace: replace,
+	})
+	b.open++
+
+	c.commit(name)
+
+}
+
+// sent counts r in the batch it belongs to; a record that belongs to none yet, as
+// those of a source, joins the open batch of the task sending it
+func (c *Checkpoint) sent(name string, r *record.Record) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	key, found := batchKey(r)
+	if !found {
+		key = name + batchSeparator + strconv.Itoa(c.taskBatches(name).open)
+		r.SetContextValue(string(task.CtxKeyCheckpoint), key)
+	}
+	c.inFlight[key]++
+
+}
+
+// handled counts a record of the batch as handled, recording the units its task
+// completed once nothing is left in flight for them
+func (c *Checkpoint) handled(key string) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.inFlight[key]--
+	if c.inFlight[key] > 0 {
+		return
+	}
+	delete(c.inFlight, key)
+
+	name, _, _ := strings.Cut(key, batchSeparator)
+	c.commit(name)
+
+}
+
+// commit records the completed units of the task, in order, up to the first one
+// with records still in flight
+func (c *Checkpoint) commit(name string) {
+
+	b := c.taskBatches(name)
+	for len(b.closed) > 0 && c.inFlight[b.closed[0].key] <= 0 {
+		c.record(name, b.closed[0])
+		b.closed = b.closed[1:]
+	}
+
+}
+
+func (c *Checkpoint) record(name string, completed *batch) {
+
+	if c.done[name] == nil || completed.replace {
+		c.done[name] = make(map[string]bool)
+	}
+	c.done[name][completed.unit] = true
+
+	if completed.replace {
+		c.state.Tasks[name] = []string{completed.unit}
+	} else {
+		c.state.Tasks[name] = append(c.state.Tasks[name], completed.unit)
+	}
+	c.dirty = true
+
+}
+
+func (c *Checkpoint) taskBatches(name string) *batches {
+
+	b, found := c.batches[name]
+	if !found {
+		b = &batches{}
+		c.batches[name] = b
+	}
+
+	return b
+
+}
+
+func (c *Checkpoint) saveEvery(interval time.Duration) {
+
+	defer close(c.stopped)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			if err := c.save(); err != nil {
+				c.logger.Warn(`cannot save checkpoint`, `path`, c.Path, `error`, err)
+			}
+		}
+	}
+
+}
+
+// save writes the recorded units, all in one go, when any were recorded since the last save
+func (c *Checkpoint) save() error {
+
+	c.Lock()
+	if !c.dirty {
+		c.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(c.state)
+	c.dirty = false
+	c.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if err := c.store.save(context.Background(), data); err != nil {
+		c.Lock()
+		c.dirty = true
+		c.Unlock()
+		return fmt.Errorf("cannot save checkpoint %s: %w", c.Path, err)
+	}
+
+	return nil
+
+}
+
+// batchKey returns the batch r belongs to
+func batchKey(r *record.Record) (string, bool) {
+
+	key, found := r.GetContextValue(string(task.CtxKeyCheckpoint))
+
+	return key, found && key != ``
+
+}
+
+// Task is one task's view of the checkpoint; it implements task.Checkpoint, and
+// task.Observer to follow the records of every batch through the task
+type Task struct {
+	name       string
+	checkpoint *Checkpoint
+
+	// the batch of the record each worker is on, keyed by the worker's input channel
+	current map[<-chan *record.Record]string
+	sync.Mutex
+}
+
+// Done reports whether an earlier run completed unit
+func (t *Task) Done(unit string) bool {
+	return t.checkpoint.isDone(t.name, unit)
+}
+
+// Complete records unit as finished, once the records sent for it are handled
+func (t *Task) Complete(unit string) error {
+	t.checkpoint.complete(t.name, unit, false)
+	return nil
+}
+
+// Advance records unit in place of the units completed before it, once the
+// records sent for it are handled
+func (t *Task) Advance(unit string) error {
+	t.checkpoint.complete(t.name, unit, true)
+	return nil
+}
+
+// Last returns the most recently completed unit
+func (t *Task) Last() (string, bool) {
+	return t.checkpoint.last(t.name)
+}
+
+// Waiting counts the record the worker was on as handled
+func (t *Task) Waiting(input <-chan *record.Record) {
+
+	t.Lock()
+	key, found := t.current[input]
+	delete(t.current, input)
+	t.Unlock()
+
+	if found {
+		t.checkpoint.handled(key)
+	}
+
+}
+
+func (t *Task) Received(input <-chan *record.Record, r *record.Record) {
+
+	if r == nil {
+		return
+	}
+
+	if key, found := batchKey(r); found {
+		t.Lock()
+		t.current[input] = key
+		t.Unlock()
+	}
+
+}
+
+func (t *Task) Sent(r *record.Record) {
+	t.checkpoint.sent(t.name, r)
+}
+
+func (t *Task) Failed(_ *record.Record, _ error) {}
@@ -0,0 +1,120 @@
+package checkpoint
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	s3client "github.com/patterninc/caterpillar/internal/pkg/pipeline/task/file/s3_client"
+)
+
+type localStore struct {
+	path string
+}
+
+func (l *localStore) load(_ context.Context) ([]byte, error) {
+
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	return data, err
+
+}
+
+// save writes a temporary file and renames it, so a crash mid-write never
+// leaves a truncated checkpoint behind
+func (l *localStore) save(_ context.Context, data []byte) error {
+
+	if dir := filepath.Dir(l.path); dir != `` {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	tmp := l.path + `.tmp`
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, l.path)
+
+}
+
+type s3Store struct {
+	path   string
+	region string
+	client *s3client.Client
+}
+
+func (s *s3Store) getClient(ctx context.Context) (*s3client.Client, error) {
+
+	if s.client == nil {
+		client, err := s3client.New(ctx, s.region)
+		if err != nil {
+			return nil, err
+		}
+		s.client = client
+	}
+
+	return s.client, nil
+
+}
+
+func (s *s3Store) load(ctx context.Context) ([]byte, error) {
+
+	client, err := s.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket, key, err := s3client.ParseURI(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer output.Body.Close()
+
+	return io.ReadAll(output.Body)
+
+}
+
+func (s *s3Store) save(ctx context.Context, data []byte) error {
+
+	client, err := s.getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	bucket, key, err := s3client.ParseURI(s.path)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+		Body:   bytes.NewReader(data),
+	})
+
+	return err
+
+}
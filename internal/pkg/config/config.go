@@ -5,7 +5,6 @@ import (
 	"strings"
 	"text/template"
 
-	"github.com/itchyny/gojq"
 	"gopkg.in/yaml.v3"
 
 	"github.com/patterninc/caterpillar/internal/pkg/jq"
@@ -32,37 +31,62 @@ func (s String) Get(r *record.Record) (string, error) {
 
 }
 
-func (s String) GetJQ(r *record.Record) (*jq.Query, error) {
+// GetJQ evaluates the templates and returns the jq query, taking the named variables
+func (s String) GetJQ(r *record.Record, variables ...string) (*jq.Query, error) {
 
 	evaluatedString, err := s.Get(r)
 	if err != nil {
 		return nil, err
 	}
 
-	query, err := gojq.Parse(evaluatedString)
+	return jq.Parse(evaluatedString, variables...)
+
+}
+
+func Load(configFile string, obj interface{}) error {
+
+	content, err := Render(configFile, false)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	jqQuery := jq.Query(*query)
+	// unmarshal object
+	if err := yaml.Unmarshal(content, obj); err != nil {
+		return err
+	}
 
-	return &jqQuery, nil
+	return nil
 
 }
 
-func Load(configFile string, obj interface{}) error {
+// Render reads configFile and executes its templates. When offline, secrets are
+// not read from the parameter store and a placeholder is put in their place.
+func Render(configFile string, offline bool) ([]byte, error) {
 
 	// read full file content
 	content, err := os.ReadFile(configFile)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	return RenderContent(content, offline)
+
+}
+
+// RenderContent executes the templates of a configuration held in memory, as Render
+// does for a file
+func RenderContent(content []byte, offline bool) ([]byte, error) {
+
+	secret := getSecret
+	if offline {
+		secret = setSecretPlaceholder
 	}
 
 	// inject secrets
 	configTemplate := template.New(templateName).Funcs(template.FuncMap{
 		"env":     getEnvironmentVariable, // returns environment variable
 		"macro":   setMacroPlaceholder,    // set placeholder string for macro replacement
-		"secret":  getSecret,              // we use this template function to inject secrets from parameter store
+		"secret":  secret,                 // we use this template function to inject secrets from parameter store
 		"context": setContextPlaceholder,  // set placeholder string for context replacement
 		// indent: add `n` spaces after every newline in the value (useful when
 		// injecting multiline values into YAML block scalars)
@@ -75,19 +99,14 @@ func Load(configFile string, obj interface{}) error {
 
 	parsedTemplate, err := configTemplate.Parse(string(content))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var preparedContext strings.Builder
 	if err := parsedTemplate.Execute(&preparedContext, nil); err != nil {
-		return err
-	}
-
-	// unmarshal object
-	if err := yaml.Unmarshal([]byte(preparedContext.String()), obj); err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return []byte(preparedContext.String()), nil
 
 }
@@ -23,6 +23,18 @@ func setContextPlaceholder(key string) (string, error) {
 	return fmt.Sprintf(contextPlaceholderString, key), nil
 }
 
+// ContextKeys returns the keys of the context templates in a rendered config value
+func ContextKeys(data string) []string {
+
+	var keys []string
+	for _, match := range contextTemplateRegex.FindAllStringSubmatch(data, -1) {
+		keys = append(keys, match[1])
+	}
+
+	return keys
+
+}
+
 func evaluateContext(data string, record *record.Record) (string, error) {
 
 	// Find all context template patterns
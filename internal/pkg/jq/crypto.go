@@ -226,12 +226,7 @@ func bcryptOptions() []gojq.CompilerOption {
 			panic(fmt.Errorf("expected string for salt for bcrypt, got %T", args[1]))
 		}
 
-		encodedSalt, version, cost, err := parseBcryptSalt(salt)
-		if err != nil {
-			panic(err)
-		}
-
-		result, err := bcryptHash(data, version, cost, encodedSalt)
+		result, err := bcryptWithSalt(data, salt)
 		if err != nil {
 			panic(err)
 		}
@@ -244,6 +239,62 @@ func bcryptOptions() []gojq.CompilerOption {
 
 }
 
+func bcryptWithSalt(data, salt string) (string, error) {
+
+	encodedSalt, version, cost, err := parseBcryptSalt(salt)
+	if err != nil {
+		return ``, err
+	}
+
+	return bcryptHash(data, version, cost, encodedSalt)
+
+}
+
+// Helper is a custom function of jq on strings, for the script task to offer
+type Helper struct {
+	MinArgs int
+	MaxArgs int
+	Call    func(args []string) (string, error)
+}
+
+// Helpers returns the custom functions of jq that work on strings by name:
+// hashes, signatures, message authentication, uuid and bcrypt. The input of a
+// hash is its first argument.
+func Helpers() map[string]Helper {
+
+	helpers := make(map[string]Helper)
+	for name, fn := range hashFuncs {
+		helpers[name] = Helper{1, 1, func(args []string) (string, error) {
+			return fn(args[0]), nil
+		}}
+	}
+	for name, fn := range signFuncs {
+		helpers[name] = Helper{2, 2, func(args []string) (string, error) {
+			return fn(args[0], []byte(args[1]))
+		}}
+	}
+	for name, fn := range messageAuthenticationFuncs {
+		helpers[name] = Helper{2, 3, func(args []string) (string, error) {
+			pref := []byte{}
+			if len(args) == 3 {
+				pref = []byte(args[2])
+			}
+			return fn(args[0], []byte(args[1]), pref), nil
+		}}
+	}
+	for name, fn := range uuidFuncs {
+		helpers[name] = Helper{0, 0, func([]string) (string, error) {
+			return fn(), nil
+		}}
+	}
+	helpers[`bcrypt`] = Helper{2, 2, func(args []string) (string, error) {
+		return bcryptWithSalt(args[0], args[1])
+	}}
+
+	return helpers
+
+}
+
 // A full hash is also a valid salt argument, since its trailing field starts with the salt.
 func parseBcryptSalt(salt string) (string, string, int, error) {
 
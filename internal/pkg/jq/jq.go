@@ -2,15 +2,65 @@ package jq
 
 import (
 	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
 
 	"github.com/itchyny/gojq"
 )
 
 const (
 	defaultResultLength = 100
+	maxCachedQueries    = 1024
 )
 
-type Query gojq.Query
+var (
+	// queries reading inputs still get them, at the cost of compiling for every run
+	readsInputs = regexp.MustCompile(`\binputs?\b`)
+	// custom functions are the same for every query, so their options are built once
+	customFunctions = customFunctionsOptions()
+	// queries rendered from templates are often the same from one record to the next
+	cache      = make(map[string]*Query)
+	cacheMutex sync.Mutex
+)
+
+// Query is a jq query compiled once, with the custom functions and the names of
+// the variables it takes; it is safe for concurrent use
+type Query struct {
+	query       *gojq.Query
+	variables   []string
+	code        *gojq.Code
+	readsInputs bool
+}
+
+// Parse parses and compiles a query taking the named variables, e.g. $page_id.
+// Queries parsed before with the same variables are reused.
+func Parse(text string, variables ...string) (*Query, error) {
+
+	key := strings.Join(append([]string{text}, variables...), "\x00")
+
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	if q, found := cache[key]; found {
+		return q, nil
+	}
+
+	q := &Query{}
+	if err := q.compile(text, variables); err != nil {
+		return nil, err
+	}
+
+	if len(cache) >= maxCachedQueries {
+		clear(cache)
+	}
+	cache[key] = q
+
+	return q, nil
+
+}
 
 func (q *Query) UnmarshalYAML(unmarshal func(any) error) error {
 	return q.parse(unmarshal)
@@ -34,18 +84,63 @@ func (q *Query) parse(unmarshal func(any) error) error {
 		return err
 	}
 
-	query, err := gojq.Parse(path)
+	return q.compile(path, nil)
+
+}
+
+func (q *Query) compile(text string, variables []string) error {
+
+	query, err := gojq.Parse(text)
+	if err != nil {
+		return err
+	}
+
+	options := append(slices.Clip(customFunctions), gojq.WithVariables(variables))
+	// a query reading inputs is compiled here only to report its errors early
+	inputs := readsInputs.MatchString(text)
+	if inputs {
+		options = append(options, gojq.WithInputIter(gojq.NewIter[any]()))
+	}
+
+	code, err := gojq.Compile(query, options...)
 	if err != nil {
 		return err
 	}
 
-	*q = Query(*query)
+	*q = Query{
+		query:       query,
+		variables:   variables,
+		code:        code,
+		readsInputs: inputs,
+	}
 
 	return nil
 
 }
 
-func (q *Query) Execute(document []byte, inputs ...any) (any, error) {
+// String returns the query as jq text
+func (q *Query) String() string {
+
+	if q.query == nil {
+		return ``
+	}
+
+	return q.query.String()
+
+}
+
+// Execute runs the query on the document, parsed as JSON or taken as a string
+// when it is not, with a value for each of its variables. Queries reading
+// inputs get the document, followed by the variables as an object keyed by
+// their names without $.
+func (q *Query) Execute(document []byte, variables ...any) (any, error) {
+
+	if q.code == nil {
+		return nil, fmt.Errorf("the query is empty")
+	}
+	if len(variables) != len(q.variables) {
+		return nil, fmt.Errorf("the query takes %d variables, got %d", len(q.variables), len(variables))
+	}
 
 	var data any
 
@@ -54,20 +149,24 @@ func (q *Query) Execute(document []byte, inputs ...any) (any, error) {
 		data = string(document)
 	}
 
-	values := make([]any, 0, len(inputs)+1)
-	values = append(values, data)
-	values = append(values, inputs...)
-
-	compilerOpts := []gojq.CompilerOption{gojq.WithInputIter(gojq.NewIter(values...))}
-	// extending compliter with custom functions...
-	compilerOpts = append(compilerOpts, customFunctionsOptions()...)
-
-	code, err := gojq.Compile((*gojq.Query)(q), compilerOpts...)
-	if err != nil {
-		return nil, err
+	code := q.code
+	if q.readsInputs {
+		inputs := []any{data}
+		if len(q.variables) > 0 {
+			named := make(map[string]any, len(q.variables))
+			for i, name := range q.variables {
+				named[strings.TrimPrefix(name, `$`)] = variables[i]
+			}
+			inputs = append(inputs, named)
+		}
+		options := append(slices.Clip(customFunctions), gojq.WithVariables(q.variables), gojq.WithInputIter(gojq.NewIter(inputs...)))
+		var err error
+		if code, err = gojq.Compile(q.query, options...); err != nil {
+			return nil, err
+		}
 	}
 
-	iter := code.Run(data)
+	iter := code.Run(data, variables...)
 
 	if iter == nil {
 		return nil, nil
@@ -101,6 +200,23 @@ func (q *Query) Execute(document []byte, inputs ...any) (any, error) {
 
 }
 
+// Match executes the query as a predicate: it matches unless the result is null
+// or false, as in jq's select
+func (q *Query) Match(document []byte) (bool, error) {
+
+	result, err := q.Execute(document)
+	if err != nil {
+		return false, err
+	}
+
+	if matched, isBool := result.(bool); isBool {
+		return matched, nil
+	}
+
+	return result != nil, nil
+
+}
+
 // returns options for additional custom functions...
 func customFunctionsOptions() []gojq.CompilerOption {
 	var options []gojq.CompilerOption
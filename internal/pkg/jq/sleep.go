@@ -2,6 +2,7 @@ package jq
 
 import (
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/itchyny/gojq"
@@ -22,7 +23,7 @@ func sleep(c any, a []any) any {
 		return fmt.Errorf("sleep: invalid duration format '%s': %v", durationStr, err)
 	}
 
-	fmt.Printf("Sleeping for %v...\n", dur)
+	slog.Debug(`sleeping`, `duration`, dur)
 	time.Sleep(dur)
 	return c
 }
@@ -0,0 +1,230 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+)
+
+const (
+	namespace     = `caterpillar`
+	defaultListen = `:9090`
+	defaultPath   = `/metrics`
+)
+
+// Metrics serves per-task pipeline metrics in the Prometheus text format. Every
+// method but Init is safe to call on a nil *Metrics, which records nothing.
+type Metrics struct {
+	Listen string `yaml:"listen,omitempty" json:"listen,omitempty"`
+	Path   string `yaml:"path,omitempty" json:"path,omitempty"`
+
+	registry    *prometheus.Registry
+	server      *http.Server
+	recordsIn   *prometheus.CounterVec
+	recordsOut  *prometheus.CounterVec
+	bytesIn     *prometheus.CounterVec
+	bytesOut    *prometheus.CounterVec
+	errors      *prometheus.CounterVec
+	discarded   *prometheus.CounterVec
+	processing  *prometheus.HistogramVec
+	channelLen  *prometheus.GaugeVec
+	channelCap  *prometheus.GaugeVec
+	channels    map[string]<-chan *record.Record
+	channelLock sync.Mutex
+}
+
+// Init creates the collectors; it is called once after unmarshaling
+func (m *Metrics) Init() error {
+
+	if m.Listen == `` {
+		m.Listen = defaultListen
+	}
+	if m.Path == `` {
+		m.Path = defaultPath
+	}
+
+	taskLabel := []string{`task`}
+
+	m.recordsIn = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      `records_in_total`,
+		Help:      `Records read by the task from its input.`,
+	}, taskLabel)
+	m.recordsOut = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      `records_out_total`,
+		Help:      `Records sent by the task to its output.`,
+	}, taskLabel)
+	m.bytesIn = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      `bytes_in_total`,
+		Help:      `Bytes of record data read by the task.`,
+	}, taskLabel)
+	m.bytesOut = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      `bytes_out_total`,
+		Help:      `Bytes of record data sent by the task.`,
+	}, taskLabel)
+	m.errors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      `errors_total`,
+		Help:      `Errors returned by the task's workers plus records it sent to dead letter.`,
+	}, taskLabel)
+	m.discarded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      `discarded_records_total`,
+		Help:      `Records drained and discarded from the task's input after its workers stopped.`,
+	}, taskLabel)
+	m.processing = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      `processing_seconds`,
+		Help:      `Time a worker spends on a record, from reading it to asking for the next one; time waiting on an empty input is not counted.`,
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16), // 0.5ms to ~16s
+	}, taskLabel)
+	m.channelLen = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      `channel_length`,
+		Help:      `Records waiting in the task's input channel.`,
+	}, taskLabel)
+	m.channelCap = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      `channel_capacity`,
+		Help:      `Capacity of the task's input channel.`,
+	}, taskLabel)
+
+	m.registry = prometheus.NewRegistry()
+	m.channels = make(map[string]<-chan *record.Record)
+
+	return m.registry.Register(&channelCollector{m})
+
+}
+
+// Start listens on the configured address and serves metrics until Stop is called
+func (m *Metrics) Start(logger *slog.Logger) error {
+
+	if m == nil {
+		return nil
+	}
+
+	listener, err := net.Listen(`tcp`, m.Listen)
+	if err != nil {
+		return fmt.Errorf("metrics: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(m.Path, promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	m.server = &http.Server{Handler: mux}
+
+	go func() {
+		if err := m.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error(`metrics server failed`, `error`, err)
+		}
+	}()
+
+	return nil
+
+}
+
+func (m *Metrics) Stop() {
+
+	if m == nil || m.server == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m.server.Shutdown(ctx)
+
+}
+
+// Task returns the observer for the named task
+func (m *Metrics) Task(name string) *Task {
+
+	if m == nil {
+		return nil
+	}
+
+	return &Task{
+		name:    name,
+		metrics: m,
+		started: make(map[<-chan *record.Record]time.Time),
+	}
+
+}
+
+// WatchChannel reports the fill level of the named task's input channel
+func (m *Metrics) WatchChannel(name string, input <-chan *record.Record) {
+
+	if m == nil || input == nil {
+		return
+	}
+
+	m.channelLock.Lock()
+	defer m.channelLock.Unlock()
+
+	m.channels[name] = input
+
+}
+
+func (m *Metrics) Discarded(name string, count int) {
+
+	if m == nil {
+		return
+	}
+
+	m.discarded.WithLabelValues(name).Add(float64(count))
+
+}
+
+// channelCollector samples channel fill levels at scrape time, alongside the task collectors
+type channelCollector struct {
+	m *Metrics
+}
+
+func (c *channelCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	for _, collector := range c.collectors() {
+		collector.Describe(ch)
+	}
+
+}
+
+func (c *channelCollector) Collect(ch chan<- prometheus.Metric) {
+
+	c.m.channelLock.Lock()
+	for name, input := range c.m.channels {
+		c.m.channelLen.WithLabelValues(name).Set(float64(len(input)))
+		c.m.channelCap.WithLabelValues(name).Set(float64(cap(input)))
+	}
+	c.m.channelLock.Unlock()
+
+	for _, collector := range c.collectors() {
+		collector.Collect(ch)
+	}
+
+}
+
+func (c *channelCollector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.m.recordsIn,
+		c.m.recordsOut,
+		c.m.bytesIn,
+		c.m.bytesOut,
+		c.m.errors,
+		c.m.discarded,
+		c.m.processing,
+		c.m.channelLen,
+		c.m.channelCap,
+	}
+}
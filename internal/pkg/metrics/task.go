@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+)
+
+// Task records the metrics of a single task; it implements task.Observer
+type Task struct {
+	name    string
+	metrics *Metrics
+
+	// when each worker read its current record, keyed by the worker's input channel
+	started map[<-chan *record.Record]time.Time
+	sync.Mutex
+}
+
+// Waiting ends the processing of the worker's current record, so the time it then
+// waits on an idle input is not counted
+func (t *Task) Waiting(input <-chan *record.Record) {
+
+	t.Lock()
+	defer t.Unlock()
+
+	if started, found := t.started[input]; found {
+		t.metrics.processing.WithLabelValues(t.name).Observe(time.Since(started).Seconds())
+		delete(t.started, input)
+	}
+
+}
+
+func (t *Task) Received(input <-chan *record.Record, r *record.Record) {
+
+	if r == nil {
+		return
+	}
+
+	t.Lock()
+	t.started[input] = time.Now()
+	t.Unlock()
+
+	t.metrics.recordsIn.WithLabelValues(t.name).Inc()
+	t.metrics.bytesIn.WithLabelValues(t.name).Add(float64(len(r.Data)))
+
+}
+
+func (t *Task) Sent(r *record.Record) {
+
+	t.metrics.recordsOut.WithLabelValues(t.name).Inc()
+	t.metrics.bytesOut.WithLabelValues(t.name).Add(float64(len(r.Data)))
+
+}
+
+func (t *Task) Failed(_ *record.Record, _ error) {
+
+	t.metrics.errors.WithLabelValues(t.name).Inc()
+
+}
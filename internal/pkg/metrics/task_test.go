@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+)
+
+// Test that a fast task on a slow input is not measured as slow: the time its
+// worker waits for the next record is not processing time
+func TestProcessingExcludesIdleInput(t *testing.T) {
+	const (
+		records = 3
+		gap     = 50 * time.Millisecond
+	)
+
+	m := &Metrics{}
+	assert.NoError(t, m.Init())
+
+	worker := &task.Base{Name: `fast`}
+	worker.SetObserver(m.Task(worker.Name))
+
+	input := make(chan *record.Record)
+	go func() {
+		for i := 0; i < records; i++ {
+			time.Sleep(gap)
+			input <- &record.Record{Data: []byte(`{}`)}
+		}
+		close(input)
+	}()
+
+	for {
+		if _, ok := worker.GetRecord(input); !ok {
+			break
+		}
+	}
+
+	families, err := m.registry.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != `caterpillar_processing_seconds` {
+			continue
+		}
+		histogram := family.GetMetric()[0].GetHistogram()
+		assert.Equal(t, uint64(records), histogram.GetSampleCount())
+		assert.Less(t, histogram.GetSampleSum(), gap.Seconds())
+		return
+	}
+	t.Fatal(`caterpillar_processing_seconds was not gathered`)
+}
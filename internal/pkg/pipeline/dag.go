@@ -9,6 +9,11 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+var (
+	nameSeparators = regexp.MustCompile(`[\[\],>\s]+`)
+	validName      = regexp.MustCompile(`^[a-zA-Z0-9_\-]+(\.[a-zA-Z0-9_\-]+)?$`)
+)
+
 type DAG struct {
 	// if the node is a task, Name is set
 	// if name is set, the rest fields are nil
@@ -40,6 +45,166 @@ func (t *DAG) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
+// taskNames returns the names of all tasks referenced by the node and its descendants
+func (t *DAG) taskNames() map[string]bool {
+
+	names := make(map[string]bool)
+
+	var walk func(*DAG)
+	walk = func(d *DAG) {
+		if d.Name != "" {
+			name, _ := splitPort(d.Name)
+			names[name] = true
+		}
+		for _, item := range d.Items {
+			walk(item)
+		}
+		for _, child := range d.Children {
+			walk(child)
+		}
+	}
+	walk(t)
+
+	return names
+
+}
+
+// portNames returns the task.port names referenced by the node and its descendants
+func (t *DAG) portNames() []string {
+
+	var names []string
+
+	var walk func(*DAG)
+	walk = func(d *DAG) {
+		if _, port := splitPort(d.Name); port != "" {
+			names = append(names, d.Name)
+		}
+		for _, item := range d.Items {
+			walk(item)
+		}
+		for _, child := range d.Children {
+			walk(child)
+		}
+	}
+	walk(t)
+
+	return names
+
+}
+
+// splitPort splits a dag name into its task and output port, which is empty
+// when the name has none
+func splitPort(name string) (string, string) {
+	taskName, port, _ := strings.Cut(name, ".")
+	return taskName, port
+}
+
+// heads returns the names of the tasks that receive the node's input
+func (t *DAG) heads() map[string]bool {
+
+	names := make(map[string]bool)
+
+	var walk func(*DAG)
+	walk = func(d *DAG) {
+		if d.Name != "" {
+			name, _ := splitPort(d.Name)
+			names[name] = true
+			return
+		}
+		for _, item := range d.Items {
+			walk(item)
+		}
+	}
+	walk(t)
+
+	return names
+
+}
+
+// routeHeads returns the tasks heading the branches of the first group after
+// the named task, with the tasks chained between them
+func (t *DAG) routeHeads(name string) map[string]bool {
+
+	edges, _ := t.edges(nil)
+	downstream := make(map[string][]string)
+	for _, e := range edges {
+		from, _ := splitPort(e.from)
+		downstream[from] = append(downstream[from], e.to)
+	}
+
+	heads := make(map[string]bool)
+	next := downstream[name]
+	for len(next) > 0 && !heads[next[0]] {
+		for _, to := range next {
+			heads[to] = true
+		}
+		if len(next) > 1 {
+			break
+		}
+		next = downstream[next[0]]
+	}
+
+	return heads
+
+}
+
+// upstream returns the tasks whose output feeds the named task
+func (t *DAG) upstream(name string) map[string]bool {
+
+	edges, _ := t.edges(nil)
+	names := make(map[string]bool)
+	for _, e := range edges {
+		if e.to == name {
+			from, _ := splitPort(e.from)
+			names[from] = true
+		}
+	}
+
+	return names
+
+}
+
+// edge links a dag name to the task it feeds; from keeps its port, if any
+type edge struct {
+	from string
+	to   string
+}
+
+// edges returns the links between the tasks of the node when upstream feeds its
+// heads, along with the names whose output leaves the node
+func (t *DAG) edges(upstream []string) ([]edge, []string) {
+
+	if t.Name != "" {
+		to, _ := splitPort(t.Name)
+		edges := make([]edge, 0, len(upstream))
+		for _, from := range upstream {
+			edges = append(edges, edge{from: from, to: to})
+		}
+		return edges, []string{t.Name}
+	}
+
+	var edges []edge
+	tails := upstream
+	if len(t.Items) > 0 {
+		tails = nil
+		for _, item := range t.Items {
+			itemEdges, itemTails := item.edges(upstream)
+			edges = append(edges, itemEdges...)
+			tails = append(tails, itemTails...)
+		}
+	}
+
+	// children run one after the other on the output of the items
+	for _, child := range t.Children {
+		childEdges, childTails := child.edges(tails)
+		edges = append(edges, childEdges...)
+		tails = childTails
+	}
+
+	return edges, tails
+
+}
+
 func cleanInput(input string) string {
 	inputString := strings.ReplaceAll(input, " ", "")
 	inputString = strings.ReplaceAll(inputString, "\n", "")
@@ -100,7 +265,7 @@ func parseInput(input string) (*DAG, error) {
 }
 
 func isNameChar(c rune) bool {
-	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || c == '-'
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || c == '-' || c == '.'
 }
 
 // Validate the input, checking for invalid characters and group syntax
@@ -111,7 +276,7 @@ func validateInput(input string) error {
 	}
 
 	// check for invalid characters
-	invalidChars, err := regexp.Compile(`[^a-zA-Z0-9_\-\[\],>\s]`)
+	invalidChars, err := regexp.Compile(`[^a-zA-Z0-9_\-.\[\],>\s]`)
 	if err != nil {
 		return fmt.Errorf("failed to compile regex: %s", err.Error())
 	}
@@ -119,6 +284,13 @@ func validateInput(input string) error {
 		return fmt.Errorf("invalid characters found")
 	}
 
+	// a name is a task, optionally followed by a single .port
+	for _, name := range nameSeparators.Split(input, -1) {
+		if name != "" && !validName.MatchString(name) {
+			return fmt.Errorf("invalid task name %s, expected task or task.port", name)
+		}
+	}
+
 	// check for leading '>'
 	if input[0] == '>' {
 		return fmt.Errorf("error at index 0, leading > found")
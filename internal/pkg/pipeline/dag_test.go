@@ -116,6 +116,11 @@ func TestValidateInput(t *testing.T) {
 			input:    "task1>>[task2,task3>>task4]",
 			expected: nil,
 		},
+		{
+			name:     "Task ports",
+			input:    "task1 >> [task2.body >> task3, task2.attachments >> task4]",
+			expected: nil,
+		},
 
 		// Invalid cases - invalid characters
 		{
@@ -139,6 +144,23 @@ func TestValidateInput(t *testing.T) {
 			expected: fmt.Errorf("invalid characters found"),
 		},
 
+		// Invalid cases - task names
+		{
+			name:     "Port without task",
+			input:    "task1 >> .body",
+			expected: fmt.Errorf("invalid task name .body, expected task or task.port"),
+		},
+		{
+			name:     "Empty port",
+			input:    "task1. >> task2",
+			expected: fmt.Errorf("invalid task name task1., expected task or task.port"),
+		},
+		{
+			name:     "Nested ports",
+			input:    "task1.body.html >> task2",
+			expected: fmt.Errorf("invalid task name task1.body.html, expected task or task.port"),
+		},
+
 		// Invalid cases - single >
 		{
 			name:     "Single > operator",
@@ -0,0 +1,331 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/patterninc/caterpillar/internal/pkg/jq"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+)
+
+const (
+	captureTaskName = `caterpillar_capture`
+	previewLength   = 500
+)
+
+// Expectations are what caterpillar test checks a run of the pipeline against;
+// running the pipeline otherwise ignores them. Records are those reaching the
+// end of the pipeline.
+type Expectations struct {
+	Error     string         `yaml:"error,omitempty" json:"error,omitempty"`         // the run fails with an error containing this text
+	Count     *int           `yaml:"count,omitempty" json:"count,omitempty"`         // number of records, len(records) when records are set
+	Records   []*Expectation `yaml:"records,omitempty" json:"records,omitempty"`     // one expectation per record
+	Unordered bool           `yaml:"unordered,omitempty" json:"unordered,omitempty"` // records may come in any order
+	Each      []*jq.Query    `yaml:"each,omitempty" json:"each,omitempty"`           // assertions every record must match
+}
+
+// Expectation is a record expected at the end of the pipeline: its data exactly,
+// its data as JSON equal to a value, or a jq assertion its data matches
+type Expectation struct {
+	Data *string   `yaml:"data,omitempty" json:"data,omitempty"`
+	JSON any       `yaml:"json,omitempty" json:"json,omitempty"`
+	JQ   *jq.Query `yaml:"jq,omitempty" json:"jq,omitempty"`
+
+	// the assertion as written, to report it
+	query string
+}
+
+func (e *Expectation) UnmarshalYAML(value *yaml.Node) error {
+
+	// json may be expected to be null, so values are kept as nodes to tell it from a missing one
+	var fields struct {
+		Data *string   `yaml:"data"`
+		JSON yaml.Node `yaml:"json"`
+		JQ   yaml.Node `yaml:"jq"`
+	}
+	if err := value.Decode(&fields); err != nil {
+		return err
+	}
+
+	set := 0
+	e.Data = fields.Data
+	if fields.Data != nil {
+		set++
+	}
+	if !fields.JSON.IsZero() {
+		if err := fields.JSON.Decode(&e.JSON); err != nil {
+			return err
+		}
+		set++
+	}
+	if !fields.JQ.IsZero() {
+		e.JQ = &jq.Query{}
+		if err := fields.JQ.Decode(e.JQ); err != nil {
+			return err
+		}
+		e.query = fields.JQ.Value
+		set++
+	}
+
+	if set != 1 {
+		return fmt.Errorf("line %d: a record expectation takes one of data, json or jq", value.Line)
+	}
+
+	return nil
+
+}
+
+// Test runs the pipeline with the records reaching its end captured, and returns
+// how the run fails its expectations; none means it passed
+func (p *Pipeline) Test(ctx context.Context) []string {
+
+	captured := p.capture()
+	err := p.Run(ctx)
+
+	expect := p.Expect
+	if expect == nil {
+		expect = &Expectations{}
+	}
+
+	return expect.check(captured.records, err)
+
+}
+
+// capture adds a task keeping the records sent by the tasks at the end of the
+// pipeline. Sinks that cannot pass records on, e.g. a file writer, keep no output.
+func (p *Pipeline) capture() *captureTask {
+
+	captured := &captureTask{Base: task.Base{Name: captureTaskName}}
+	canPass := func(t task.Task) bool {
+		placed, ok := t.(task.Placed)
+		return !ok || placed.Positions()&task.PositionMiddle != 0
+	}
+
+	if p.DAG != nil {
+		p.DAG = p.withCapture(p.DAG, true, canPass)
+	} else {
+		// tasks of the dead_letter branch do not run in the chain
+		var deadLetterTasks map[string]bool
+		if p.DeadLetter != nil {
+			deadLetterTasks = p.DeadLetter.taskNames()
+		}
+		var last task.Task
+		for _, t := range p.Tasks {
+			if !deadLetterTasks[t.GetName()] {
+				last = t
+			}
+		}
+		if last == nil || !canPass(last) {
+			return captured
+		}
+	}
+
+	p.Tasks = append(p.Tasks, captured)
+	p.tasksToMap()
+
+	return captured
+
+}
+
+// withCapture returns the dag with the capture task after every leaf that can
+// pass records on; leaves are found the way executeDag finds them
+func (p *Pipeline) withCapture(item *DAG, isLeaf bool, canPass func(task.Task) bool) *DAG {
+
+	if item.Name != `` {
+		name, _ := splitPort(item.Name)
+		if t, found := p.taskByName[name]; !isLeaf || !found || !canPass(t) {
+			return item
+		}
+		return &DAG{Items: []*DAG{item}, Children: []*DAG{{Name: captureTaskName}}}
+	}
+
+	captured := &DAG{}
+	for _, it := range item.Items {
+		captured.Items = append(captured.Items, p.withCapture(it, isLeaf && len(item.Children) == 0, canPass))
+	}
+	for i, child := range item.Children {
+		captured.Children = append(captured.Children, p.withCapture(child, isLeaf && i == len(item.Children)-1, canPass))
+	}
+
+	return captured
+
+}
+
+// captureTask is the in-memory sink caterpillar test reads records from
+type captureTask struct {
+	task.Base
+	records []*record.Record
+	sync.Mutex
+}
+
+func (c *captureTask) Run(_ context.Context, input <-chan *record.Record, _ chan<- *record.Record) error {
+
+	for {
+		r, ok := c.GetRecord(input)
+		if !ok {
+			break
+		}
+		c.Lock()
+		c.records = append(c.records, r)
+		c.Unlock()
+	}
+
+	return nil
+
+}
+
+func (e *Expectations) check(records []*record.Record, runErr error) []string {
+
+	var failures []string
+
+	switch {
+	case e.Error == `` && runErr != nil:
+		failures = append(failures, fmt.Sprintf("the run failed: %s", strings.TrimSpace(runErr.Error())))
+	case e.Error != `` && runErr == nil:
+		failures = append(failures, fmt.Sprintf("expected the run to fail with %q, but it succeeded", e.Error))
+	case e.Error != `` && !strings.Contains(runErr.Error(), e.Error):
+		failures = append(failures, fmt.Sprintf("expected the run to fail with %q, but it failed with: %s", e.Error, strings.TrimSpace(runErr.Error())))
+	}
+
+	if e.Count != nil && *e.Count != len(records) {
+		failures = append(failures, fmt.Sprintf("expected %d records, got %d", *e.Count, len(records)))
+	}
+
+	for _, query := range e.Each {
+		for i, r := range records {
+			if matched, err := query.Match(r.Data); err != nil || !matched {
+				failures = append(failures, fmt.Sprintf("record %d does not match the each assertion%s:\n+ %s", i+1, describeError(err), preview(r.Data)))
+			}
+		}
+	}
+
+	if e.Records == nil {
+		return failures
+	}
+
+	if e.Count == nil && len(e.Records) != len(records) {
+		failures = append(failures, fmt.Sprintf("expected %d records, got %d", len(e.Records), len(records)))
+	}
+
+	if e.Unordered {
+		return append(failures, e.checkUnordered(records)...)
+	}
+
+	for i := 0; i < max(len(e.Records), len(records)); i++ {
+		switch {
+		case i >= len(records):
+			failures = append(failures, fmt.Sprintf("record %d is missing:\n- %s", i+1, e.Records[i]))
+		case i >= len(e.Records):
+			failures = append(failures, fmt.Sprintf("record %d is not expected:\n+ %s", i+1, preview(records[i].Data)))
+		default:
+			if matched, err := e.Records[i].match(records[i]); !matched {
+				failures = append(failures, fmt.Sprintf("record %d differs%s:\n- %s\n+ %s", i+1, describeError(err), e.Records[i], preview(records[i].Data)))
+			}
+		}
+	}
+
+	return failures
+
+}
+
+// checkUnordered matches every expectation with the first record left that it fits
+func (e *Expectations) checkUnordered(records []*record.Record) []string {
+
+	var failures []string
+
+	matched := make([]bool, len(records))
+	for _, expectation := range e.Records {
+		found := false
+		for i, r := range records {
+			if matched[i] {
+				continue
+			}
+			if ok, _ := expectation.match(r); ok {
+				matched[i], found = true, true
+				break
+			}
+		}
+		if !found {
+			failures = append(failures, fmt.Sprintf("no record matches:\n- %s", expectation))
+		}
+	}
+
+	for i, r := range records {
+		if !matched[i] {
+			failures = append(failures, fmt.Sprintf("record is not expected:\n+ %s", preview(r.Data)))
+		}
+	}
+
+	return failures
+
+}
+
+// match reports whether the record meets the expectation, with the error that
+// kept it from being compared, if any
+func (e *Expectation) match(r *record.Record) (bool, error) {
+
+	switch {
+	case e.Data != nil:
+		return *e.Data == string(r.Data), nil
+	case e.JQ != nil:
+		return e.JQ.Match(r.Data)
+	}
+
+	var actual any
+	if err := json.Unmarshal(r.Data, &actual); err != nil {
+		return false, err
+	}
+
+	// yaml and json decode numbers and maps to different types, so compare both as json
+	data, err := json.Marshal(e.JSON)
+	if err != nil {
+		return false, err
+	}
+	var expected any
+	if err := json.Unmarshal(data, &expected); err != nil {
+		return false, err
+	}
+
+	return reflect.DeepEqual(expected, actual), nil
+
+}
+
+func (e *Expectation) String() string {
+
+	switch {
+	case e.Data != nil:
+		return *e.Data
+	case e.JQ != nil:
+		return fmt.Sprintf("jq: %s", e.query)
+	}
+
+	data, err := json.Marshal(e.JSON)
+	if err != nil {
+		return fmt.Sprintf("json: %v", e.JSON)
+	}
+
+	return string(data)
+
+}
+
+func describeError(err error) string {
+	if err == nil {
+		return ``
+	}
+	return fmt.Sprintf(" (%v)", err)
+}
+
+// preview shortens the data of a record to report it
+func preview(data []byte) string {
+	if len(data) <= previewLength {
+		return string(data)
+	}
+	return fmt.Sprintf("%s... (%d bytes)", data[:previewLength], len(data))
+}
@@ -0,0 +1,123 @@
+package pipeline
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+)
+
+// Test that a pipeline run is checked against its expectations
+func TestPipelineTest(t *testing.T) {
+	tests := []struct {
+		name     string
+		dag      string
+		failing  bool
+		expect   string
+		expected []string
+	}{
+		{
+			name: "Records in order",
+			expect: `
+records:
+  - data: "0"
+  - json: 1
+  - jq: . == 2
+`,
+		},
+		{
+			name: "Differing, missing and unexpected records",
+			expect: `
+records:
+  - data: "0"
+  - data: "5"
+`,
+			expected: []string{
+				"expected 2 records, got 3",
+				"record 2 differs:\n- 5\n+ 1",
+				"record 3 is not expected:\n+ 2",
+			},
+		},
+		{
+			name: "Count and each assertion",
+			expect: `
+count: 2
+each:
+  - . < 2
+`,
+			expected: []string{
+				"expected 2 records, got 3",
+				"record 3 does not match the each assertion:\n+ 2",
+			},
+		},
+		{
+			name: "Unordered records of every branch",
+			dag:  `source >> [left, right]`,
+			expect: `
+unordered: true
+records:
+  - data: "2"
+  - data: "2"
+  - data: "1"
+  - data: "1"
+  - data: "0"
+  - data: "3"
+`,
+			expected: []string{
+				"no record matches:\n- 3",
+				"record is not expected:\n+ 0",
+			},
+		},
+		{
+			name:    "Expected error",
+			failing: true,
+			expect: `
+error: bad record
+records: []
+`,
+		},
+		{
+			name:    "Unexpected error",
+			failing: true,
+			expect: `
+count: 0
+`,
+			expected: []string{
+				"the run failed: pipeline failed with errors:\nTask 'sink' failed with error: bad record (2 records discarded)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expect := &Expectations{}
+			assert.NoError(t, yaml.Unmarshal([]byte(tt.expect), expect))
+
+			p := &Pipeline{
+				Tasks:  tasks{&counter{Base: task.Base{Name: "source"}, count: 3}},
+				Expect: expect,
+			}
+			switch {
+			case tt.failing:
+				p.Tasks = append(p.Tasks, &failing{Base: task.Base{Name: "sink", FailOnError: true}})
+			case tt.dag != ``:
+				p.Tasks = append(p.Tasks, &task.Base{Name: "left"}, &task.Base{Name: "right"})
+				p.DAG = &DAG{}
+				assert.NoError(t, yaml.Unmarshal([]byte(tt.dag), p.DAG))
+			}
+			assert.NoError(t, p.Init())
+
+			assert.Equal(t, tt.expected, p.Test(context.Background()))
+		})
+	}
+}
+
+// Test that a record expectation takes exactly one kind of check
+func TestExpectationKinds(t *testing.T) {
+	for _, config := range []string{`{}`, `{data: a, json: a}`, `{jq: ., data: a}`} {
+		assert.ErrorContains(t, yaml.Unmarshal([]byte(config), &Expectation{}), "a record expectation takes one of data, json or jq", config)
+	}
+}
@@ -0,0 +1,281 @@
+package pipeline
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+)
+
+// Graph is the topology of a pipeline: the tasks that run and the channels
+// between them, each buffered to ChannelSize records
+type Graph struct {
+	ChannelSize int          `json:"channel_size"`
+	Nodes       []*GraphNode `json:"nodes"`
+	Edges       []*GraphEdge `json:"edges"`
+}
+
+// GraphNode is a task of the pipeline. ID is the task name, or its position in
+// tasks when the name is empty or repeated.
+type GraphNode struct {
+	ID            string `json:"id"`
+	Name          string `json:"name,omitempty"`
+	Type          string `json:"type,omitempty"`
+	Concurrency   int    `json:"concurrency"`
+	PreserveOrder bool   `json:"preserve_order,omitempty"`
+	DeadLetter    bool   `json:"dead_letter,omitempty"`
+}
+
+// GraphEdge is a channel from one task to the next. Port is the output port the
+// records leave on, Routed marks the branches a router picks between, and
+// DeadLetter the records failed by tasks with on_error: dead_letter.
+type GraphEdge struct {
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Port       string `json:"port,omitempty"`
+	Routed     bool   `json:"routed,omitempty"`
+	DeadLetter bool   `json:"dead_letter,omitempty"`
+}
+
+// Graph returns the topology of the pipeline: the dag and the dead_letter branch
+// when set, the tasks in order otherwise. Tasks the dag leaves out never run
+// and are not part of it.
+func (p *Pipeline) Graph() *Graph {
+
+	g := &Graph{ChannelSize: p.ChannelSize}
+	if g.ChannelSize <= 0 {
+		g.ChannelSize = defaultChannelSize
+	}
+
+	var dagTasks, deadLetterTasks map[string]bool
+	if p.DAG != nil {
+		dagTasks = p.DAG.taskNames()
+	}
+	if p.DeadLetter != nil {
+		deadLetterTasks = p.DeadLetter.taskNames()
+	}
+
+	counts := make(map[string]int)
+	for _, t := range p.Tasks {
+		counts[t.GetName()]++
+	}
+
+	// nodes of the dag are found by name; the first task wins, as when running
+	nodes := make(map[string]*GraphNode)
+	byTask := make(map[task.Task]*GraphNode)
+	for i, t := range p.Tasks {
+		name := t.GetName()
+		if dagTasks != nil && !dagTasks[name] && !deadLetterTasks[name] {
+			continue
+		}
+		node := &GraphNode{
+			ID:            name,
+			Name:          name,
+			Type:          t.GetType(),
+			Concurrency:   t.GetTaskConcurrency(),
+			PreserveOrder: t.GetPreserveOrder(),
+			DeadLetter:    deadLetterTasks[name],
+		}
+		if name == `` || counts[name] > 1 {
+			node.ID = fmt.Sprintf("%s#%d", name, i+1)
+		}
+		if _, found := nodes[name]; !found {
+			nodes[name] = node
+		}
+		byTask[t] = node
+		g.Nodes = append(g.Nodes, node)
+	}
+
+	// names the dag cannot resolve still show up, without a type
+	node := func(name string) *GraphNode {
+		if n, found := nodes[name]; found {
+			return n
+		}
+		n := &GraphNode{ID: name, Name: name, Concurrency: defaultTaskConcurrency, DeadLetter: deadLetterTasks[name]}
+		nodes[name] = n
+		g.Nodes = append(g.Nodes, n)
+		return n
+	}
+
+	// a task wired by port appears once per port in the dag, but runs once
+	linked := make(map[GraphEdge]bool)
+	link := func(from, to string) {
+		fromName, port := splitPort(from)
+		edge := GraphEdge{From: node(fromName).ID, To: node(to).ID, Port: port}
+		if router, ok := p.taskByName[fromName].(task.Router); ok {
+			edge.Routed = slices.Contains(router.Targets(), to)
+		}
+		if !linked[edge] {
+			linked[edge] = true
+			g.Edges = append(g.Edges, &edge)
+		}
+	}
+
+	if p.DAG != nil {
+		edges, _ := p.DAG.edges(nil)
+		for _, e := range edges {
+			link(e.from, e.to)
+		}
+	} else {
+		var previous *GraphNode
+		for _, n := range g.Nodes {
+			if n.DeadLetter {
+				continue
+			}
+			if previous != nil {
+				g.Edges = append(g.Edges, &GraphEdge{From: previous.ID, To: n.ID})
+			}
+			previous = n
+		}
+	}
+
+	if p.DeadLetter != nil {
+		edges, _ := p.DeadLetter.edges([]string{``})
+		for _, e := range edges {
+			if e.from != `` {
+				link(e.from, e.to)
+			}
+		}
+		heads := sortedNames(p.DeadLetter.heads())
+		for _, t := range p.Tasks {
+			from, found := byTask[t]
+			if !found || t.GetOnError() != task.OnErrorDeadLetter {
+				continue
+			}
+			for _, head := range heads {
+				g.Edges = append(g.Edges, &GraphEdge{From: from.ID, To: node(head).ID, DeadLetter: true})
+			}
+		}
+	}
+
+	return g
+
+}
+
+// DOT renders the graph in the Graphviz dot language
+func (g *Graph) DOT() string {
+
+	var b strings.Builder
+
+	b.WriteString("digraph pipeline {\n")
+	b.WriteString("\trankdir=LR;\n")
+	fmt.Fprintf(&b, "\tlabel=%q;\n", fmt.Sprintf("channel_size: %d", g.ChannelSize))
+	b.WriteString("\tnode [shape=box];\n")
+
+	var deadLetter []*GraphNode
+	for _, n := range g.Nodes {
+		if n.DeadLetter {
+			deadLetter = append(deadLetter, n)
+			continue
+		}
+		fmt.Fprintf(&b, "\t%q [label=%q];\n", n.ID, n.label("\n"))
+	}
+
+	if len(deadLetter) > 0 {
+		b.WriteString("\tsubgraph cluster_dead_letter {\n")
+		b.WriteString("\t\tlabel=\"dead_letter\";\n")
+		b.WriteString("\t\tstyle=dashed;\n")
+		for _, n := range deadLetter {
+			fmt.Fprintf(&b, "\t\t%q [label=%q];\n", n.ID, n.label("\n"))
+		}
+		b.WriteString("\t}\n")
+	}
+
+	for _, e := range g.Edges {
+		var attributes []string
+		if label := e.label(); label != `` {
+			attributes = append(attributes, fmt.Sprintf("label=%q", label))
+		}
+		if e.DeadLetter {
+			attributes = append(attributes, `style=dashed`)
+		}
+		if len(attributes) == 0 {
+			fmt.Fprintf(&b, "\t%q -> %q;\n", e.From, e.To)
+			continue
+		}
+		fmt.Fprintf(&b, "\t%q -> %q [%s];\n", e.From, e.To, strings.Join(attributes, `, `))
+	}
+
+	b.WriteString("}\n")
+
+	return b.String()
+
+}
+
+// Mermaid renders the graph as a mermaid flowchart, which GitHub shows inline
+// in markdown
+func (g *Graph) Mermaid() string {
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "---\ntitle: \"channel_size: %d\"\n---\n", g.ChannelSize)
+	b.WriteString("flowchart LR\n")
+
+	// mermaid ids cannot hold every task name, so nodes are numbered
+	ids := make(map[string]string, len(g.Nodes))
+	var deadLetter []string
+	for i, n := range g.Nodes {
+		ids[n.ID] = fmt.Sprintf("n%d", i)
+		line := fmt.Sprintf("%s[\"%s\"]\n", ids[n.ID], strings.ReplaceAll(n.label("<br/>"), `"`, `#quot;`))
+		if n.DeadLetter {
+			deadLetter = append(deadLetter, line)
+			continue
+		}
+		b.WriteString("    " + line)
+	}
+
+	if len(deadLetter) > 0 {
+		b.WriteString("    subgraph dead_letter\n")
+		for _, line := range deadLetter {
+			b.WriteString("        " + line)
+		}
+		b.WriteString("    end\n")
+	}
+
+	for _, e := range g.Edges {
+		label := e.label()
+		switch {
+		case e.DeadLetter:
+			fmt.Fprintf(&b, "    %s -. %s .-> %s\n", ids[e.From], label, ids[e.To])
+		case label != ``:
+			fmt.Fprintf(&b, "    %s -- %s --> %s\n", ids[e.From], label, ids[e.To])
+		default:
+			fmt.Fprintf(&b, "    %s --> %s\n", ids[e.From], ids[e.To])
+		}
+	}
+
+	return b.String()
+
+}
+
+// label describes the node on separate lines: name, type and workers
+func (n *GraphNode) label(separator string) string {
+
+	lines := []string{n.ID}
+	if n.Type != `` {
+		lines = append(lines, n.Type)
+	}
+	if n.Concurrency > 1 {
+		workers := fmt.Sprintf("%d workers", n.Concurrency)
+		if n.PreserveOrder {
+			workers += `, ordered`
+		}
+		lines = append(lines, workers)
+	}
+
+	return strings.Join(lines, separator)
+
+}
+
+func (e *GraphEdge) label() string {
+	switch {
+	case e.DeadLetter:
+		return task.OnErrorDeadLetter
+	case e.Port != ``:
+		return e.Port
+	case e.Routed:
+		return `route`
+	}
+	return ``
+}
@@ -0,0 +1,146 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that Graph resolves the tasks and channels the pipeline runs
+func TestGraph(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected *Graph
+	}{
+		{
+			name: "Linear tasks",
+			config: `
+channel_size: 100
+tasks:
+  - name: read
+    type: file
+    path: names.txt
+  - type: split
+  - name: greet
+    type: jq
+    path: '"Hello, " + .'
+    task_concurrency: 4
+    preserve_order: true
+  - name: greet
+    type: echo
+`,
+			expected: &Graph{
+				ChannelSize: 100,
+				Nodes: []*GraphNode{
+					{ID: `read`, Name: `read`, Type: `file`, Concurrency: 1},
+					{ID: `#2`, Type: `split`, Concurrency: 1},
+					{ID: `greet#3`, Name: `greet`, Type: `jq`, Concurrency: 4, PreserveOrder: true},
+					{ID: `greet#4`, Name: `greet`, Type: `echo`, Concurrency: 1},
+				},
+				Edges: []*GraphEdge{
+					{From: `read`, To: `#2`},
+					{From: `#2`, To: `greet#3`},
+					{From: `greet#3`, To: `greet#4`},
+				},
+			},
+		},
+		{
+			name: "Dag with routes and dead letter",
+			config: `
+tasks:
+  - name: read
+    type: file
+    path: names.txt
+  - name: by_length
+    type: route
+    routes:
+      - when: length > 5
+        to: long
+    default: short
+    on_error: dead_letter
+  - name: long
+    type: echo
+  - name: short
+    type: echo
+  - name: unused
+    type: echo
+  - name: failed
+    type: echo
+dag: read >> by_length >> [long, short]
+dead_letter: failed
+`,
+			expected: &Graph{
+				ChannelSize: defaultChannelSize,
+				Nodes: []*GraphNode{
+					{ID: `read`, Name: `read`, Type: `file`, Concurrency: 1},
+					{ID: `by_length`, Name: `by_length`, Type: `route`, Concurrency: 1},
+					{ID: `long`, Name: `long`, Type: `echo`, Concurrency: 1},
+					{ID: `short`, Name: `short`, Type: `echo`, Concurrency: 1},
+					{ID: `failed`, Name: `failed`, Type: `echo`, Concurrency: 1, DeadLetter: true},
+				},
+				Edges: []*GraphEdge{
+					{From: `read`, To: `by_length`},
+					{From: `by_length`, To: `long`, Routed: true},
+					{From: `by_length`, To: `short`, Routed: true},
+					{From: `by_length`, To: `failed`, DeadLetter: true},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, problems := Decode([]byte(tt.config))
+			assert.Empty(t, problems)
+			assert.Equal(t, tt.expected, p.Graph())
+		})
+	}
+}
+
+// Test that the graph renders as mermaid and dot
+func TestGraphRender(t *testing.T) {
+
+	g := &Graph{
+		ChannelSize: 10,
+		Nodes: []*GraphNode{
+			{ID: `parse`, Name: `parse`, Type: `converter`, Concurrency: 2, PreserveOrder: true},
+			{ID: `body`, Name: `body`, Type: `echo`, Concurrency: 1},
+			{ID: `failed`, Name: `failed`, Type: `echo`, Concurrency: 1, DeadLetter: true},
+		},
+		Edges: []*GraphEdge{
+			{From: `parse`, To: `body`, Port: `body`},
+			{From: `parse`, To: `failed`, DeadLetter: true},
+		},
+	}
+
+	assert.Equal(t, `---
+title: "channel_size: 10"
+---
+flowchart LR
+    n0["parse<br/>converter<br/>2 workers, ordered"]
+    n1["body<br/>echo"]
+    subgraph dead_letter
+        n2["failed<br/>echo"]
+    end
+    n0 -- body --> n1
+    n0 -. dead_letter .-> n2
+`, g.Mermaid())
+
+	assert.Equal(t, `digraph pipeline {
+	rankdir=LR;
+	label="channel_size: 10";
+	node [shape=box];
+	"parse" [label="parse\nconverter\n2 workers, ordered"];
+	"body" [label="body\necho"];
+	subgraph cluster_dead_letter {
+		label="dead_letter";
+		style=dashed;
+		"failed" [label="failed\necho"];
+	}
+	"parse" -> "body" [label="body"];
+	"parse" -> "failed" [label="dead_letter", style=dashed];
+}
+`, g.DOT())
+
+}
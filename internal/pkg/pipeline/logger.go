@@ -0,0 +1,40 @@
+package pipeline
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+const (
+	defaultLogLevel  = `info`
+	defaultLogFormat = `text`
+)
+
+// newLogger builds the pipeline logger; logs go to stderr so they never mix with
+// record output on stdout
+func newLogger(level, format string) (*slog.Logger, error) {
+
+	if level == `` {
+		level = defaultLogLevel
+	}
+	if format == `` {
+		format = defaultLogFormat
+	}
+
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log_level: %s", level)
+	}
+	options := &slog.HandlerOptions{Level: logLevel}
+
+	switch format {
+	case `text`:
+		return slog.New(slog.NewTextHandler(os.Stderr, options)), nil
+	case `json`:
+		return slog.New(slog.NewJSONHandler(os.Stderr, options)), nil
+	default:
+		return nil, fmt.Errorf("invalid log_format: %s (must be 'text' or 'json')", format)
+	}
+
+}
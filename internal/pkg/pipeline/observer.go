@@ -0,0 +1,33 @@
+package pipeline
+
+import (
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+)
+
+// taskObservers tells every observer of a task, e.g. metrics and tracing, in order
+type taskObservers []task.Observer
+
+func (o taskObservers) Waiting(input <-chan *record.Record) {
+	for _, observer := range o {
+		observer.Waiting(input)
+	}
+}
+
+func (o taskObservers) Received(input <-chan *record.Record, r *record.Record) {
+	for _, observer := range o {
+		observer.Received(input, r)
+	}
+}
+
+func (o taskObservers) Sent(r *record.Record) {
+	for _, observer := range o {
+		observer.Sent(r)
+	}
+}
+
+func (o taskObservers) Failed(r *record.Record, err error) {
+	for _, observer := range o {
+		observer.Failed(r, err)
+	}
+}
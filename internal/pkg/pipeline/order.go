@@ -0,0 +1,194 @@
+package pipeline
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+)
+
+// endOfRecord is written to a worker's output when the worker reads its next
+// record, marking the end of what it sent for the previous one
+var endOfRecord = &record.Record{}
+
+// orderedWorkers feeds the workers of a task with preserve_order in turn and
+// re-sequences their output, so records leave in the order they arrived
+type orderedWorkers struct {
+	inputs   []<-chan *record.Record
+	outputs  []chan *record.Record // one per worker, closed by the worker when it returns
+	done     []chan struct{}       // closed by each worker when it returns
+	assigned chan int              // worker of each record, in input order
+	workers  map[<-chan *record.Record]*orderedWorker
+	wg       sync.WaitGroup
+	held     atomic.Int64 // records taken from input for a worker that had already returned
+}
+
+// orderedWorker is only touched by the goroutine of its worker
+type orderedWorker struct {
+	output   chan<- *record.Record
+	started  bool
+	finished bool
+}
+
+// orderInput splits input between the workers of a task and sends their output to
+// output in input order. Each worker buffers up to buffer records of output while
+// an earlier record is still being processed.
+func (p *Pipeline) orderInput(input <-chan *record.Record, output chan<- *record.Record, concurrency, buffer int) *orderedWorkers {
+
+	o := &orderedWorkers{
+		inputs:   make([]<-chan *record.Record, concurrency),
+		outputs:  make([]chan *record.Record, concurrency),
+		done:     make([]chan struct{}, concurrency),
+		assigned: make(chan int, concurrency*3),
+		workers:  make(map[<-chan *record.Record]*orderedWorker, concurrency),
+	}
+
+	queues := make([]chan *record.Record, concurrency)
+	o.wg.Add(concurrency + 2)
+
+	for i := range concurrency {
+		in := make(chan *record.Record)
+		o.inputs[i] = in
+		o.outputs[i] = make(chan *record.Record, max(1, buffer))
+		o.done[i] = make(chan struct{})
+		o.workers[in] = &orderedWorker{output: o.outputs[i]}
+		queues[i] = make(chan *record.Record, 1)
+
+		// the queue lets the dispatcher move on while the worker is busy, which the
+		// resequencer relies on to get the next record to the worker it waits for
+		go func(queue <-chan *record.Record, in chan<- *record.Record, done <-chan struct{}) {
+			defer o.wg.Done()
+			defer close(in)
+			for r := range queue {
+				select {
+				case in <- r:
+				case <-done:
+					o.held.Add(1)
+				}
+			}
+		}(queues[i], in, o.done[i])
+	}
+
+	// dispatch records to the workers in turn, skipping those that have returned
+	go func() {
+		defer o.wg.Done()
+		defer close(o.assigned)
+		defer func() {
+			for _, queue := range queues {
+				close(queue)
+			}
+		}()
+		next := 0
+		for r := range input {
+			worker, ok := o.nextWorker(next)
+			if !ok {
+				o.held.Add(1)
+				continue
+			}
+			next = worker + 1
+			o.assigned <- worker
+			queues[worker] <- r
+		}
+	}()
+
+	go func() {
+		defer o.wg.Done()
+		o.resequence(output)
+	}()
+
+	return o
+
+}
+
+// nextWorker returns the first worker from start on that has not returned
+func (o *orderedWorkers) nextWorker(start int) (int, bool) {
+
+	for i := range len(o.done) {
+		worker := (start + i) % len(o.done)
+		select {
+		case <-o.done[worker]:
+		default:
+			return worker, true
+		}
+	}
+	return 0, false
+
+}
+
+// resequence forwards the output of each record once all earlier records are done
+func (o *orderedWorkers) resequence(output chan<- *record.Record) {
+
+	for worker := range o.assigned {
+		for r := range o.outputs[worker] {
+			if r == endOfRecord {
+				break
+			}
+			output <- r
+		}
+	}
+
+	// what workers send once their input is closed, e.g. a final flush
+	for _, out := range o.outputs {
+		for r := range out {
+			if r != endOfRecord {
+				output <- r
+			}
+		}
+	}
+
+}
+
+// wait returns once every record was forwarded, with the number of records dropped
+func (o *orderedWorkers) wait() int {
+
+	o.wg.Wait()
+	return int(o.held.Load())
+
+}
+
+// observer wraps next so the end of every record is marked in its worker's output
+func (o *orderedWorkers) observer(next task.Observer) task.Observer {
+	return &orderObserver{workers: o.workers, next: next}
+}
+
+// orderObserver marks the end of a record when its worker reads the next one;
+// the worker has sent everything for the previous record by then
+type orderObserver struct {
+	workers map[<-chan *record.Record]*orderedWorker
+	next    task.Observer
+}
+
+func (o *orderObserver) Received(input <-chan *record.Record, r *record.Record) {
+
+	if w := o.workers[input]; w != nil && !w.finished {
+		if w.started {
+			w.output <- endOfRecord
+		}
+		w.started = true
+		w.finished = r == nil
+	}
+
+	if o.next != nil {
+		o.next.Received(input, r)
+	}
+
+}
+
+func (o *orderObserver) Waiting(input <-chan *record.Record) {
+	if o.next != nil {
+		o.next.Waiting(input)
+	}
+}
+
+func (o *orderObserver) Sent(r *record.Record) {
+	if o.next != nil {
+		o.next.Sent(r)
+	}
+}
+
+func (o *orderObserver) Failed(r *record.Record, err error) {
+	if o.next != nil {
+		o.next.Failed(r, err)
+	}
+}
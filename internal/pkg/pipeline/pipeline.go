@@ -1,11 +1,19 @@
 package pipeline
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"slices"
 	"sync"
+	"sync/atomic"
 
+	"github.com/patterninc/caterpillar/internal/pkg/checkpoint"
+	"github.com/patterninc/caterpillar/internal/pkg/metrics"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/exec_plugin"
+	"github.com/patterninc/caterpillar/internal/pkg/tracing"
 	"gopkg.in/yaml.v3"
 )
 
@@ -15,45 +23,264 @@ const (
 )
 
 type Pipeline struct {
-	Tasks       tasks `yaml:"tasks,omitempty" json:"tasks,omitempty"`
-	ChannelSize int   `yaml:"channel_size,omitempty" json:"channel_size,omitempty"`
-	DAG         *DAG  `yaml:"dag,omitempty" json:"dag,omitempty"`
+	Tasks       tasks                  `yaml:"tasks,omitempty" json:"tasks,omitempty"`
+	ChannelSize int                    `yaml:"channel_size,omitempty" json:"channel_size,omitempty"`
+	DAG         *DAG                   `yaml:"dag,omitempty" json:"dag,omitempty"`
+	DeadLetter  *DAG                   `yaml:"dead_letter,omitempty" json:"dead_letter,omitempty"`
+	Metrics     *metrics.Metrics       `yaml:"metrics,omitempty" json:"metrics,omitempty"`
+	Tracing     *tracing.Tracing       `yaml:"tracing,omitempty" json:"tracing,omitempty"`
+	Checkpoint  *checkpoint.Checkpoint `yaml:"checkpoint,omitempty" json:"checkpoint,omitempty"`
+	LogLevel    string                 `yaml:"log_level,omitempty" json:"log_level,omitempty"`
+	LogFormat   string                 `yaml:"log_format,omitempty" json:"log_format,omitempty"`
+	Expect      *Expectations          `yaml:"expect,omitempty" json:"expect,omitempty"`
+	Plugins     []*exec_plugin.Plugin  `yaml:"plugins,omitempty" json:"plugins,omitempty"`
 	taskByName  map[string]task.Task
 	wg          *sync.WaitGroup
 	locker      *sync.Mutex
 	errors      map[string]error
+	discarded   map[string]int
+	failures    int // tasks that returned an error, with or without fail_on_error
+	cancel      context.CancelCauseFunc
+	logger      *slog.Logger
+	hubs        map[string]*portHub
+
+	// records failed by tasks with on_error: dead_letter, closed once all of them are done
+	deadLetter        chan *record.Record
+	deadLetterWriters *sync.WaitGroup
 }
 
 func (p *Pipeline) Init() error {
-	if p.DAG != nil {
-		p.tasksToMap()
+	logger, err := newLogger(p.LogLevel, p.LogFormat)
+	if err != nil {
+		return err
+	}
+	p.logger = logger
+
+	p.tasksToMap()
+
+	if err := p.validateDeadLetter(); err != nil {
+		return err
+	}
+
+	if err := p.validateRoutes(); err != nil {
+		return err
+	}
+
+	if err := p.validatePorts(); err != nil {
+		return err
+	}
+
+	if err := p.validateSideInputs(); err != nil {
+		return err
+	}
+
+	if p.Metrics != nil {
+		if err := p.Metrics.Init(); err != nil {
+			return err
+		}
+	}
+
+	if p.Checkpoint != nil {
+		if err := p.Checkpoint.Init(); err != nil {
+			return err
+		}
+	}
+
+	if p.Tracing != nil {
+		if err := p.Tracing.Init(); err != nil {
+			return err
+		}
 	}
 
 	p.wg = &sync.WaitGroup{}
 	p.locker = &sync.Mutex{}
 	p.errors = make(map[string]error)
+	p.discarded = make(map[string]int)
+	p.deadLetterWriters = &sync.WaitGroup{}
+	return nil
+}
+
+// validateDeadLetter checks that the dead_letter branch and the tasks routing to it agree
+func (p *Pipeline) validateDeadLetter() error {
+
+	var deadLetterTasks map[string]bool
+	if p.DeadLetter != nil {
+		deadLetterTasks = p.DeadLetter.taskNames()
+		for name := range deadLetterTasks {
+			t, found := p.taskByName[name]
+			if !found {
+				return fmt.Errorf("dead_letter task not found: %s", name)
+			}
+			if t.GetOnError() == task.OnErrorDeadLetter {
+				return fmt.Errorf("task %s is in the dead_letter branch and cannot use on_error: %s", name, task.OnErrorDeadLetter)
+			}
+		}
+		if p.DAG != nil {
+			for name := range p.DAG.taskNames() {
+				if deadLetterTasks[name] {
+					return fmt.Errorf("task %s cannot be in both dag and dead_letter", name)
+				}
+			}
+		}
+	}
+
+	for _, t := range p.Tasks {
+		if t.GetOnError() == task.OnErrorDeadLetter && p.DeadLetter == nil {
+			return fmt.Errorf("task %s has on_error: %s but the pipeline has no dead_letter branch", t.GetName(), task.OnErrorDeadLetter)
+		}
+	}
+
+	return nil
+
+}
+
+// validateRoutes checks that the tasks records are routed to head a branch of
+// the first group after the route task
+func (p *Pipeline) validateRoutes() error {
+
+	for _, t := range p.Tasks {
+		router, ok := t.(task.Router)
+		if !ok {
+			continue
+		}
+		if p.DAG == nil {
+			return fmt.Errorf("task %s routes records and needs a dag", t.GetName())
+		}
+		dagTasks := p.DAG.taskNames()
+		heads := p.DAG.routeHeads(t.GetName())
+		for _, target := range router.Targets() {
+			if !dagTasks[target] {
+				return fmt.Errorf("task %s routes records to %s, which is not in the dag", t.GetName(), target)
+			}
+			if !heads[target] {
+				return fmt.Errorf("task %s routes records to %s, which heads no branch of the group after it", t.GetName(), target)
+			}
+		}
+	}
+
 	return nil
+
+}
+
+// validateSideInputs checks that the side inputs of a task end branches of the
+// group before it, next to the branches of its other input
+func (p *Pipeline) validateSideInputs() error {
+
+	for _, t := range p.Tasks {
+		reader, ok := t.(task.SideInputReader)
+		if !ok || len(reader.SideInputs()) == 0 {
+			continue
+		}
+		if p.DAG == nil {
+			return fmt.Errorf("task %s reads a side input and needs a dag", t.GetName())
+		}
+		upstream := p.DAG.upstream(t.GetName())
+		for _, sideInput := range reader.SideInputs() {
+			if !upstream[sideInput] {
+				return fmt.Errorf("task %s reads side input %s, which ends no branch of the group before it", t.GetName(), sideInput)
+			}
+			if len(upstream) == 1 {
+				return fmt.Errorf("task %s reads side input %s, which is its only input", t.GetName(), sideInput)
+			}
+		}
+	}
+
+	return nil
+
+}
+
+// isSideInput reports whether a task reads the records of the named one as side input
+func (p *Pipeline) isSideInput(name string) bool {
+
+	for _, t := range p.Tasks {
+		if reader, ok := t.(task.SideInputReader); ok && slices.Contains(reader.SideInputs(), name) {
+			return true
+		}
+	}
+
+	return false
+
 }
 
 func (p *Pipeline) UnmarshalYAML(value *yaml.Node) error {
 	type pipeline Pipeline // avoid infinite recursion
 	var temp pipeline
 
-	if err := value.Decode(&temp); err != nil {
+	// plugins define task types, so tasks are decoded once the rest is
+	sections, tasksNode := *value, mappingValue(value, `tasks`)
+	if tasksNode != nil {
+		sections.Content = nil
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			if value.Content[i+1] != tasksNode {
+				sections.Content = append(sections.Content, value.Content[i], value.Content[i+1])
+			}
+		}
+	}
+
+	if err := sections.Decode(&temp); err != nil {
 		return err
 	}
 
 	*p = Pipeline(temp)
 
+	if err := p.validatePlugins(); err != nil {
+		return err
+	}
+
+	if tasksNode != nil {
+		nodes := make([]yaml.Node, 0, 10)
+		if err := tasksNode.Decode(&nodes); err != nil {
+			return err
+		}
+		decoded, err := decodeTasks(nodes, p.taskConstructor)
+		if err != nil {
+			return err
+		}
+		p.Tasks = decoded
+	}
+
 	return p.Init()
 }
 
-func (p *Pipeline) Run() error {
+// Logger returns the logger configured by log_level and log_format
+func (p *Pipeline) Logger() *slog.Logger {
+	return p.logger
+}
+
+// Task returns the task with the given name, e.g. to feed a memory source or
+// read a collect sink
+func (p *Pipeline) Task(name string) (task.Task, bool) {
+	t, found := p.taskByName[name]
+	return t, found
+}
+
+// Run executes the pipeline until every task has finished. Cancelling ctx is a
+// graceful stop: sources stop producing, records already in flight drain
+// through the remaining tasks, and Run returns once they are done.
+//
+// A task with fail_on_error that returns an error stops the sources the same way,
+// so the run always ends with a verdict instead of waiting on a stalled upstream.
+func (p *Pipeline) Run(ctx context.Context) error {
+
+	ctx, p.cancel = context.WithCancelCause(ctx)
+	defer p.cancel(nil)
+
+	// tasks of the dead_letter branch only ever see failed records
+	mainTasks := p.Tasks
+	if p.DeadLetter != nil {
+		deadLetterTasks := p.DeadLetter.taskNames()
+		mainTasks = make(tasks, 0, len(p.Tasks))
+		for _, t := range p.Tasks {
+			if !deadLetterTasks[t.GetName()] {
+				mainTasks = append(mainTasks, t)
+			}
+		}
+	}
 
-	tasksCount := len(p.Tasks)
+	tasksCount := len(mainTasks)
 
 	if tasksCount == 0 {
-		fmt.Println(`nothing to do.`)
+		p.logger.Info(`nothing to do`)
 		return nil
 	}
 
@@ -61,6 +288,32 @@ func (p *Pipeline) Run() error {
 		p.ChannelSize = defaultChannelSize
 	}
 
+	if err := p.Checkpoint.Open(ctx, p.logger); err != nil {
+		return err
+	}
+	defer p.Checkpoint.Close()
+
+	if err := p.Metrics.Start(p.logger); err != nil {
+		return err
+	}
+	defer p.Metrics.Stop()
+
+	defer func() {
+		if err := p.Tracing.Stop(); err != nil {
+			p.logger.Warn(`cannot export spans`, `error`, err)
+		}
+	}()
+
+	// tasks wired by port are started once all their occurrences are known
+	p.hubs = p.portHubs()
+
+	if p.DeadLetter != nil {
+		p.deadLetter = make(chan *record.Record, p.ChannelSize)
+		if _, err := p.executeDag(ctx, p.DeadLetter, p.deadLetter, true); err != nil {
+			return err
+		}
+	}
+
 	// sync
 	if p.DAG == nil {
 		// data streams
@@ -73,23 +326,50 @@ func (p *Pipeline) Run() error {
 				input = nil
 			}
 
-			p.runTaskConcurrently(p.Tasks[i], input, output)
+			p.runTaskConcurrently(ctx, mainTasks[i], input, output)
 
 			output = input
 		}
 	} else {
-		_, err := p.executeDag(p.DAG, nil, true)
+		_, err := p.executeDag(ctx, p.DAG, nil, true)
 		if err != nil {
 			return err
 		}
 	}
+
+	p.startHubs(ctx)
+
+	if p.deadLetter != nil {
+		go func() {
+			p.deadLetterWriters.Wait()
+			close(p.deadLetter)
+		}()
+	}
+
 	// wait for all tasks completion
 	p.wg.Wait()
 
+	if ctx.Err() != nil {
+		p.logger.Warn(`pipeline stopped early: sources stopped and in-flight records drained`, `cause`, context.Cause(ctx))
+	}
+
+	// units are recorded as their records are handled; once the run ends without
+	// losing any, the units of tasks that read ahead of what they handle are too
+	if p.failures == 0 && len(p.discarded) == 0 {
+		p.Checkpoint.CommitAll()
+	}
+	if err := p.Checkpoint.Close(); err != nil {
+		return err
+	}
+
 	if len(p.errors) > 0 {
 		var errorDetails string
 		for taskName, err := range p.errors {
-			errorDetails += fmt.Sprintf("Task '%s' failed with error: %s\n", taskName, err)
+			errorDetails += fmt.Sprintf("Task '%s' failed with error: %s", taskName, err)
+			if discarded := p.discarded[taskName]; discarded > 0 {
+				errorDetails += fmt.Sprintf(" (%d records discarded)", discarded)
+			}
+			errorDetails += "\n"
 		}
 		return fmt.Errorf("pipeline failed with errors:\n%s", errorDetails)
 	}
@@ -106,71 +386,107 @@ func (p *Pipeline) tasksToMap() {
 	p.taskByName = taskMap
 }
 
-func (p *Pipeline) executeDag(item *DAG, input <-chan *record.Record, isLeaf bool) (<-chan *record.Record, error) {
+func (p *Pipeline) executeDag(ctx context.Context, item *DAG, input <-chan *record.Record, isLeaf bool) (<-chan *record.Record, error) {
 	// Process a single task
 	if item.Name != "" {
-		return p.runTask(item.Name, input, isLeaf)
+		return p.runTask(ctx, item.Name, input, isLeaf)
 	}
 
 	// Process items in parallel first
-	itemsOutput, err := p.processItems(item.Items, input, isLeaf && len(item.Children) == 0) // is a leaf if is in the leaf path and has no children
+	itemsOutput, err := p.processItems(ctx, item.Items, input, isLeaf && len(item.Children) == 0) // is a leaf if is in the leaf path and has no children
 	if err != nil {
 		return nil, err
 	}
 
 	// Then process children with items output
-	return p.processChildren(item.Children, itemsOutput, isLeaf) // is a leaf if in the leaf path
+	return p.processChildren(ctx, item.Children, itemsOutput, isLeaf) // is a leaf if in the leaf path
 }
 
-func (p *Pipeline) runTask(taskName string, input <-chan *record.Record, isLeaf bool) (<-chan *record.Record, error) {
+func (p *Pipeline) runTask(ctx context.Context, name string, input <-chan *record.Record, isLeaf bool) (<-chan *record.Record, error) {
+	taskName, port := splitPort(name)
 	task, found := p.taskByName[taskName]
 	if !found {
 		return nil, fmt.Errorf("task not found: %s", taskName)
 	}
 
+	if hub, found := p.hubs[taskName]; found {
+		return hub.add(port, input, isLeaf, p.ChannelSize), nil
+	}
+
 	var output chan *record.Record
 	if !isLeaf {
 		output = make(chan *record.Record, p.ChannelSize)
 	}
 
-	p.runTaskConcurrently(task, input, output)
+	p.runTaskConcurrently(ctx, task, input, output)
 
 	return output, nil
 }
 
-func (p *Pipeline) processItems(items []*DAG, input <-chan *record.Record, isLeaf bool) (<-chan *record.Record, error) {
+func (p *Pipeline) processItems(ctx context.Context, items []*DAG, input <-chan *record.Record, isLeaf bool) (<-chan *record.Record, error) {
 	// Create input channels for parallel processing
 	inputChannels := make([]chan *record.Record, len(items))
 	outputChannels := make([]<-chan *record.Record, len(items))
+	heads := make([]map[string]bool, len(items))
+	fed := make(map[string]bool) // tasks wired by port that already get this input
 
 	for i, item := range items {
-		if input != nil {
+		heads[i] = item.heads()
+		if input != nil && !p.fedByPort(heads[i], fed) {
 			inputChannels[i] = make(chan *record.Record, p.ChannelSize)
 		}
-		outChan, err := p.executeDag(item, inputChannels[i], isLeaf)
+		outChan, err := p.executeDag(ctx, item, inputChannels[i], isLeaf)
 		if err != nil {
 			return nil, err
 		}
 		if outChan != nil {
+			if _, tails := item.edges(nil); len(tails) == 1 {
+				if name, _ := splitPort(tails[0]); p.isSideInput(name) {
+					outChan = p.markSideInput(outChan, name)
+				}
+			}
 			outputChannels[i] = outChan
 		}
 	}
 
-	// Distribute input to all parallel branches
-	go p.distributeToChannels(input, inputChannels)
+	// Distribute input to all parallel branches, or to the one a record is routed to
+	go p.distributeToChannels(input, inputChannels, heads)
 
 	// Merge outputs from all parallel branches
 	return p.mergeChannels(outputChannels), nil
 }
 
-func (p *Pipeline) processChildren(children []*DAG, input <-chan *record.Record, isLeaf bool) (<-chan *record.Record, error) {
+// fedByPort reports whether a branch is headed by a task wired by port that an
+// earlier branch of the group already feeds, as in a >> [b.x >> c, b.y >> d];
+// the task runs once, so it must not receive every record twice
+func (p *Pipeline) fedByPort(heads map[string]bool, fed map[string]bool) bool {
+
+	if len(heads) != 1 {
+		return false
+	}
+
+	for name := range heads {
+		if _, found := p.hubs[name]; !found {
+			return false
+		}
+		if fed[name] {
+			return true
+		}
+		fed[name] = true
+	}
+
+	return false
+
+}
+
+func (p *Pipeline) processChildren(ctx context.Context, children []*DAG, input <-chan *record.Record, isLeaf bool) (<-chan *record.Record, error) {
 	if len(children) == 0 {
 		return input, nil
 	}
 
 	currentOutput := input
 	for _, child := range children {
-		nextOutput, err := p.executeDag(child, currentOutput, isLeaf)
+		nextOutput, err := p.executeDag(ctx, child, currentOutput, isLeaf)
 		if err != nil {
 			return nil, err
 		}
@@ -180,7 +496,7 @@ func (p *Pipeline) processChildren(children []*DAG, input <-chan *record.Record,
 	return currentOutput, nil
 }
 
-func (p *Pipeline) distributeToChannels(input <-chan *record.Record, outputs []chan *record.Record) {
+func (p *Pipeline) distributeToChannels(input <-chan *record.Record, outputs []chan *record.Record, heads []map[string]bool) {
 	defer func() {
 		for _, ch := range outputs {
 			if ch != nil {
@@ -189,15 +505,83 @@ func (p *Pipeline) distributeToChannels(input <-chan *record.Record, outputs []c
 		}
 	}()
 
+	branches := 0
+	for _, ch := range outputs {
+		if ch != nil {
+			branches++
+		}
+	}
+
 	for rec := range input {
+		if i := routedBranch(rec, heads); i >= 0 {
+			if outputs[i] != nil {
+				outputs[i] <- rec
+			} else {
+				p.Checkpoint.Dropped(rec)
+			}
+			continue
+		}
+		// a record routed past a chain of tasks goes on to the group it is routed in;
+		// in a group, one whose target heads none of its branches goes nowhere
+		if target, found := rec.GetContextValue(string(task.CtxKeyRoute)); found && target != "" && len(outputs) > 1 {
+			p.logger.Warn(`dropping record routed to no branch`, `record_id`, rec.ID, `origin`, rec.Origin, `route`, target)
+			p.Checkpoint.Dropped(rec)
+			continue
+		}
+		if branches == 0 {
+			p.Checkpoint.Dropped(rec)
+			continue
+		}
+		// every branch gets a record of its own, so tasks setting context on it do not race
+		p.Checkpoint.Forked(rec, branches-1)
 		for _, ch := range outputs {
 			if ch != nil {
-				ch <- rec
+				branchRecord := *rec
+				ch <- &branchRecord
 			}
 		}
 	}
 }
 
+// routedBranch returns the index of the branch a route task sent rec to, or -1
+// when rec is not routed or none of the branches is headed by its target. The
+// route is cleared once taken, so it does not apply to groups further down.
+func routedBranch(rec *record.Record, heads []map[string]bool) int {
+
+	target, found := rec.GetContextValue(string(task.CtxKeyRoute))
+	if !found || target == "" {
+		return -1
+	}
+
+	for i, names := range heads {
+		if names[target] {
+			rec.SetContextValue(string(task.CtxKeyRoute), "")
+			return i
+		}
+	}
+
+	return -1
+
+}
+
+// markSideInput sets the side input the records of a branch end on, for the task
+// reading it to tell them from the records of the other branches
+func (p *Pipeline) markSideInput(input <-chan *record.Record, name string) <-chan *record.Record {
+
+	output := make(chan *record.Record, p.ChannelSize)
+
+	go func() {
+		defer close(output)
+		for rec := range input {
+			rec.SetContextValue(string(task.CtxKeySideInput), name)
+			output <- rec
+		}
+	}()
+
+	return output
+
+}
+
 func (p *Pipeline) mergeChannels(inputs []<-chan *record.Record) <-chan *record.Record {
 	output := make(chan *record.Record, p.ChannelSize)
 
@@ -226,12 +610,70 @@ func (p *Pipeline) mergeChannels(inputs []<-chan *record.Record) <-chan *record.
 	return output
 }
 
-func (p *Pipeline) runTaskConcurrently(t task.Task, input <-chan *record.Record, output chan<- *record.Record) {
+func (p *Pipeline) runTaskConcurrently(ctx context.Context, t task.Task, input <-chan *record.Record, output chan<- *record.Record) {
 	// wait for all workers of this task to finish
 	p.wg.Add(1)
 
+	// wire the dead-letter channel before any worker can fail a record
+	deadLetterWriter := t.GetOnError() == task.OnErrorDeadLetter && p.deadLetter != nil
+	if deadLetterWriter {
+		t.SetDeadLetter(p.deadLetter)
+		p.deadLetterWriters.Add(1)
+	}
+
+	t.SetLogger(p.logger)
+
+	var observers taskObservers
+	if p.Metrics != nil {
+		observers = append(observers, p.Metrics.Task(t.GetName()))
+		p.Metrics.WatchChannel(t.GetName(), input)
+	}
+	if p.Tracing != nil {
+		observers = append(observers, p.Tracing.Task(t.GetName()))
+	}
+	if p.Checkpoint != nil {
+		taskCheckpoint := p.Checkpoint.Task(t.GetName())
+		t.SetCheckpoint(taskCheckpoint)
+		observers = append(observers, taskCheckpoint)
+	}
+
+	var observer task.Observer
+	switch len(observers) {
+	case 0:
+	case 1:
+		observer = observers[0]
+	default:
+		observer = observers
+	}
+	if observer != nil {
+		t.SetObserver(observer)
+	}
+
 	concurrency := t.GetTaskConcurrency()
 
+	// workers share the input and output channels unless they need telling apart
+	workerInputs := make([]<-chan *record.Record, concurrency)
+	workerOutputs := make([]chan<- *record.Record, concurrency)
+	for i := range workerInputs {
+		workerInputs[i] = input
+		workerOutputs[i] = output
+	}
+	var split *workerSplit
+	var ordered *orderedWorkers
+	switch {
+	case concurrency <= 1 || input == nil:
+	case t.GetPreserveOrder() && output != nil:
+		ordered = p.orderInput(input, output, concurrency, p.ChannelSize/concurrency)
+		t.SetObserver(ordered.observer(observer))
+		workerInputs = ordered.inputs
+		for i, out := range ordered.outputs {
+			workerOutputs[i] = out
+		}
+	case observer != nil:
+		split = p.splitInput(input, concurrency)
+		workerInputs = split.inputs
+	}
+
 	// wait group for task workers
 	taskWg := sync.WaitGroup{}
 	taskWg.Add(concurrency)
@@ -239,23 +681,124 @@ func (p *Pipeline) runTaskConcurrently(t task.Task, input <-chan *record.Record,
 	for i := 0; i < concurrency; i++ {
 		go func(task task.Task, in <-chan *record.Record, out chan<- *record.Record) {
 			defer taskWg.Done()
+			if split != nil {
+				defer close(split.done[i])
+			}
+			if ordered != nil {
+				defer close(ordered.done[i])
+				defer close(ordered.outputs[i])
+			}
 
-			if err := task.Run(in, out); err != nil {
-				fmt.Printf("error in %s: %s\n", task.GetName(), err)
+			if err := task.Run(ctx, in, out); err != nil {
+				p.logger.Error(`task failed`, `task`, task.GetName(), `error`, err)
+				if observer != nil {
+					observer.Failed(nil, err)
+				}
+				p.locker.Lock()
+				p.failures++
+				p.locker.Unlock()
 				if task.GetFailOnError() {
 					p.locker.Lock()
 					p.errors[task.GetName()] = err
 					p.locker.Unlock()
+					// the run has failed, so stop the sources rather than process the rest
+					p.cancel(fmt.Errorf("task %s failed", task.GetName()))
 				}
 			}
-		}(t, input, output)
+		}(t, workerInputs[i], workerOutputs[i])
 	}
 
-	go func(wg *sync.WaitGroup, out chan<- *record.Record) {
+	go func(wg *sync.WaitGroup, in <-chan *record.Record, out chan<- *record.Record) {
 		wg.Wait()
+		// records of workers that returned are still being re-sequenced
+		discarded := 0
+		if ordered != nil {
+			discarded += ordered.wait()
+		}
 		if out != nil {
 			close(out)
 		}
+		if deadLetterWriter {
+			p.deadLetterWriters.Done()
+		}
+		// workers that stopped early leave their input open, so keep draining it
+		// or the upstream blocks forever on a full channel
+		discarded += p.drain(in)
+		if split != nil {
+			discarded += split.wait()
+		}
+		if discarded > 0 {
+			p.logger.Warn(`task stopped early, discarded records from its input`, `task`, t.GetName(), `discarded`, discarded)
+			p.locker.Lock()
+			p.discarded[t.GetName()] += discarded
+			p.locker.Unlock()
+			p.Metrics.Discarded(t.GetName(), discarded)
+		}
 		p.wg.Done()
-	}(&taskWg, output)
+	}(&taskWg, input, output)
+}
+
+// workerSplit feeds each worker of a task from its own channel
+type workerSplit struct {
+	inputs []<-chan *record.Record
+	done   []chan struct{} // closed by each worker when it returns
+	wg     sync.WaitGroup
+	held   atomic.Int64 // records taken from input for a worker that had already returned
+}
+
+// splitInput gives each worker its own unbuffered channel fed from input, so the
+// worker reading a record can be identified by the channel it read it from
+func (p *Pipeline) splitInput(input <-chan *record.Record, concurrency int) *workerSplit {
+
+	split := &workerSplit{
+		inputs: make([]<-chan *record.Record, concurrency),
+		done:   make([]chan struct{}, concurrency),
+	}
+	split.wg.Add(concurrency)
+
+	for i := range concurrency {
+		in := make(chan *record.Record)
+		split.inputs[i] = in
+		split.done[i] = make(chan struct{})
+
+		go func(in chan<- *record.Record, done <-chan struct{}) {
+			defer split.wg.Done()
+			defer close(in)
+			for r := range input {
+				select {
+				case in <- r:
+				case <-done:
+					split.held.Add(1)
+					return
+				}
+			}
+		}(in, split.done[i])
+	}
+
+	return split
+
+}
+
+// wait returns once every forwarder has stopped, with the number of records they dropped
+func (s *workerSplit) wait() int {
+
+	s.wg.Wait()
+	return int(s.held.Load())
+
+}
+
+// drain reads input until it is closed and returns how many records it discarded
+func (p *Pipeline) drain(input <-chan *record.Record) int {
+
+	if input == nil {
+		return 0
+	}
+
+	discarded := 0
+	for range input {
+		discarded++
+	}
+
+	return discarded
+
 }
@@ -0,0 +1,955 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+
+	"github.com/patterninc/caterpillar/internal/pkg/config"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+	"github.com/patterninc/caterpillar/internal/pkg/tracing"
+)
+
+// counter emits count records, gap apart, and ignores ctx, like a source that
+// cannot be interrupted
+type counter struct {
+	task.Base
+	count int
+	gap   time.Duration
+}
+
+func (c *counter) Run(_ context.Context, _ <-chan *record.Record, output chan<- *record.Record) error {
+	for i := 0; i < c.count; i++ {
+		time.Sleep(c.gap)
+		c.SendData(nil, fmt.Appendf(nil, "%d", i), output)
+	}
+	return nil
+}
+
+// failing returns an error on the first record it reads
+type failing struct {
+	task.Base
+}
+
+func (f *failing) Run(_ context.Context, input <-chan *record.Record, _ chan<- *record.Record) error {
+	if _, ok := f.GetRecord(input); ok {
+		return fmt.Errorf("bad record")
+	}
+	return nil
+}
+
+// Test that a task stopping early never blocks its upstream on a full channel
+func TestRunDrainsStoppedTask(t *testing.T) {
+	tests := []struct {
+		name        string
+		failOnError bool
+		concurrency int
+	}{
+		{
+			name: "Without fail_on_error",
+		},
+		{
+			name:        "With fail_on_error",
+			failOnError: true,
+		},
+		{
+			name:        "With fail_on_error and concurrent workers",
+			failOnError: true,
+			concurrency: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Pipeline{
+				ChannelSize: 1,
+				Tasks: tasks{
+					&counter{Base: task.Base{Name: "source"}, count: 100},
+					&failing{Base: task.Base{Name: "sink", FailOnError: tt.failOnError, TaskConcurrency: tt.concurrency}},
+				},
+			}
+			assert.NoError(t, p.Init())
+
+			done := make(chan error, 1)
+			go func() {
+				done <- p.Run(context.Background())
+			}()
+
+			select {
+			case err := <-done:
+				if tt.failOnError {
+					assert.ErrorContains(t, err, "pipeline failed with errors:")
+					assert.ErrorContains(t, err, "records discarded")
+				} else {
+					assert.NoError(t, err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("pipeline did not terminate")
+			}
+		})
+	}
+}
+
+// Test that a routed record only reaches the branch headed by its target
+func TestDistributeToRoutedBranch(t *testing.T) {
+	tests := []struct {
+		name     string
+		route    string
+		expected []int // records received by each branch
+	}{
+		{
+			name:     "Not routed",
+			expected: []int{1, 1, 1},
+		},
+		{
+			name:     "Routed to a single task branch",
+			route:    "a",
+			expected: []int{1, 0, 0},
+		},
+		{
+			name:     "Routed to a chained branch",
+			route:    "b",
+			expected: []int{0, 1, 0},
+		},
+		{
+			name:     "Routed to a task heading no branch",
+			route:    "c",
+			expected: []int{0, 0, 0},
+		},
+	}
+
+	dag, err := parseInput(cleanInput("[a, b >> c, d]"))
+	assert.NoError(t, err)
+	items := dag.Items[0].Items
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			heads := make([]map[string]bool, len(items))
+			outputs := make([]chan *record.Record, len(items))
+			for i, item := range items {
+				heads[i] = item.heads()
+				outputs[i] = make(chan *record.Record, 1)
+			}
+
+			rec := &record.Record{}
+			if tt.route != "" {
+				rec.SetContextValue(string(task.CtxKeyRoute), tt.route)
+			}
+
+			input := make(chan *record.Record, 1)
+			input <- rec
+			close(input)
+
+			p := &Pipeline{logger: slog.New(slog.DiscardHandler)}
+			p.distributeToChannels(input, outputs, heads)
+
+			for i, output := range outputs {
+				received := 0
+				for range output {
+					received++
+				}
+				assert.Equal(t, tt.expected[i], received, "branch %d", i)
+			}
+		})
+	}
+}
+
+// ported emits one record on each of its ports and one without a port
+type ported struct {
+	task.Base
+}
+
+func (s *ported) Ports() []string {
+	return []string{"odd", "even"}
+}
+
+func (s *ported) Run(_ context.Context, _ <-chan *record.Record, output chan<- *record.Record) error {
+	for _, port := range []string{"odd", "even", ""} {
+		r := &record.Record{}
+		if port != "" {
+			r.SetContextValue(string(task.CtxKeyPort), port)
+		}
+		s.SendData(r.Context, []byte(port), output)
+	}
+	return nil
+}
+
+// collector records the data of every record it reads
+type collector struct {
+	task.Base
+	received []string
+}
+
+func (c *collector) Run(_ context.Context, input <-chan *record.Record, _ chan<- *record.Record) error {
+	for {
+		r, ok := c.GetRecord(input)
+		if !ok {
+			return nil
+		}
+		c.received = append(c.received, string(r.Data))
+	}
+}
+
+// Test that a task wired by port runs once and each occurrence gets its port
+func TestRunDispatchesPorts(t *testing.T) {
+	odd := &collector{Base: task.Base{Name: "odd_sink"}}
+	even := &collector{Base: task.Base{Name: "even_sink"}}
+	rest := &collector{Base: task.Base{Name: "rest_sink"}}
+
+	dag := &DAG{}
+	assert.NoError(t, yaml.Unmarshal([]byte("'[source.odd >> odd_sink, source.even >> even_sink, source >> rest_sink]'"), dag))
+
+	p := &Pipeline{
+		Tasks: tasks{&ported{Base: task.Base{Name: "source"}}, odd, even, rest},
+		DAG:   dag,
+	}
+	assert.NoError(t, p.Init())
+	assert.NoError(t, p.Run(context.Background()))
+
+	assert.Equal(t, []string{"odd"}, odd.received)
+	assert.Equal(t, []string{"even"}, even.received)
+	assert.Equal(t, []string{""}, rest.received)
+}
+
+// tagger sets its name on every record it reads, and keeps the records
+type tagger struct {
+	task.Base
+	received []*record.Record
+}
+
+func (g *tagger) Run(_ context.Context, input <-chan *record.Record, _ chan<- *record.Record) error {
+	for {
+		r, ok := g.GetRecord(input)
+		if !ok {
+			return nil
+		}
+		r.SetContextValue("tagged_by", g.Name)
+		g.received = append(g.received, r)
+	}
+}
+
+// Test that the tasks wired to the same port each get a record of their own
+func TestRunDispatchesPortCopies(t *testing.T) {
+	first := &tagger{Base: task.Base{Name: "first"}}
+	second := &tagger{Base: task.Base{Name: "second"}}
+
+	// the sinks read the port's channels directly, with no group in between
+	dag := &DAG{Items: []*DAG{
+		{Items: []*DAG{{Name: "source.odd"}}, Children: []*DAG{{Name: "first"}}},
+		{Items: []*DAG{{Name: "source.odd"}}, Children: []*DAG{{Name: "second"}}},
+	}}
+
+	p := &Pipeline{
+		Tasks: tasks{&ported{Base: task.Base{Name: "source"}}, first, second},
+		DAG:   dag,
+	}
+	assert.NoError(t, p.Init())
+	assert.NoError(t, p.Run(context.Background()))
+
+	for _, sink := range []*tagger{first, second} {
+		assert.Len(t, sink.received, 1)
+		for _, r := range sink.received {
+			taggedBy, _ := r.GetContextValue("tagged_by")
+			assert.Equal(t, sink.Name, taggedBy)
+		}
+	}
+}
+
+// shuffler sends each record twice after a random delay, and drops every tenth
+type shuffler struct {
+	task.Base
+}
+
+func (s *shuffler) Run(_ context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
+	for {
+		r, ok := s.GetRecord(input)
+		if !ok {
+			return nil
+		}
+		time.Sleep(time.Duration(rand.IntN(1000)) * time.Microsecond)
+		if r.ID%10 == 0 {
+			continue
+		}
+		s.SendData(r.Context, r.Data, output)
+		s.SendData(r.Context, r.Data, output)
+	}
+}
+
+// Test that concurrent workers with preserve_order send records in input order
+func TestRunPreservesOrder(t *testing.T) {
+	tests := []struct {
+		name        string
+		channelSize int
+		concurrency int
+	}{
+		{
+			name:        "Single worker",
+			channelSize: 100,
+			concurrency: 1,
+		},
+		{
+			name:        "Concurrent workers",
+			channelSize: 100,
+			concurrency: 8,
+		},
+		{
+			name:        "More workers than buffered records",
+			channelSize: 1,
+			concurrency: 8,
+		},
+	}
+
+	expected := []string{}
+	for i := range 200 {
+		if (i+1)%10 != 0 {
+			expected = append(expected, fmt.Sprint(i), fmt.Sprint(i))
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &collector{Base: task.Base{Name: "sink"}}
+			p := &Pipeline{
+				ChannelSize: tt.channelSize,
+				Tasks: tasks{
+					&counter{Base: task.Base{Name: "source"}, count: 200},
+					&shuffler{Base: task.Base{Name: "shuffle", TaskConcurrency: tt.concurrency, PreserveOrder: true}},
+					sink,
+				},
+			}
+			assert.NoError(t, p.Init())
+			assert.NoError(t, p.Run(context.Background()))
+			assert.Equal(t, expected, sink.received)
+		})
+	}
+}
+
+// Test that records given inline and fed from Go reach a collect sink Go can read
+func TestRunCollectsMemoryRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), `pipeline.yaml`)
+	assert.NoError(t, os.WriteFile(path, []byte(`
+tasks:
+  - name: source
+    type: memory
+    records:
+      - data: Ada
+        context:
+          greeting: Hello
+      - data: {name: Grace}
+        context:
+          greeting: Dear
+  - name: greet
+    type: jq
+    path: '"{{ context "greeting" }}, " + (.name? // .)'
+  - name: results
+    type: collect
+`), 0o644))
+
+	p := &Pipeline{}
+	assert.NoError(t, config.Load(path, p))
+
+	source, found := p.Task("source")
+	assert.True(t, found)
+	fed := &record.Record{Data: []byte("Alan")}
+	fed.SetContextValue("greeting", "Hi")
+	source.(task.Feeder).Feed(fed)
+
+	assert.NoError(t, p.Run(context.Background()))
+
+	results, found := p.Task("results")
+	assert.True(t, found)
+	var data []string
+	for _, r := range results.(task.Collector).Records() {
+		data = append(data, string(r.Data))
+	}
+	assert.Equal(t, []string{`"Hello, Ada"`, `"Dear, Grace"`, `"Hi, Alan"`}, data)
+}
+
+// Test that enrich tells its side input by the branch it ends, so the records
+// of a pass-through task ending the side branch still build the table
+func TestRunEnrichesFromFilteredSideInput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), `pipeline.yaml`)
+	assert.NoError(t, os.WriteFile(path, []byte(`
+tasks:
+  - name: languages
+    type: memory
+    records:
+      - data: {language: French, greeting: Bonjour}
+      - data: {language: German, greeting: Hallo}
+      - data: {language: Latin, greeting: Salve}
+  - name: spoken
+    type: filter
+    when: .language != "Latin"
+  - name: people
+    type: memory
+    records:
+      - data: {name: Ada, language: French}
+      - data: {name: Grace, language: German}
+      - data: {name: Cicero, language: Latin}
+  - name: greet
+    type: enrich
+    side_input: spoken
+    key: .language
+    table_key: .language
+    join: inner
+    wait: 5s
+    fields:
+      - greeting
+  - name: results
+    type: collect
+dag: '[languages >> spoken, people] >> greet >> results'
+`), 0o644))
+
+	p := &Pipeline{}
+	assert.NoError(t, config.Load(path, p))
+	assert.NoError(t, p.Run(context.Background()))
+
+	results, found := p.Task("results")
+	assert.True(t, found)
+	var data []string
+	for _, r := range results.(task.Collector).Records() {
+		data = append(data, string(r.Data))
+	}
+	assert.ElementsMatch(t, []string{
+		`{"greeting":"Bonjour","language":"French","name":"Ada"}`,
+		`{"greeting":"Hallo","language":"German","name":"Grace"}`,
+	}, data)
+}
+
+// Test that a plugin receives records with their context, and that the records
+// it replies with keep that context
+func TestRunExecPlugin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), `pipeline.yaml`)
+	assert.NoError(t, os.WriteFile(path, []byte(`
+plugins:
+  - type: twice
+    command: sh
+    args:
+      - -c
+      - |
+        while IFS= read -r line; do
+          printf '{"records":[%s,%s]}\n' "$line" "$line"
+        done
+        echo '{"records":[{"data":"'$CATERPILLAR_TASK_NAME' done","context":{"greeting":"Bye"}}]}'
+tasks:
+  - name: source
+    type: memory
+    records:
+      - data: Ada
+        context:
+          greeting: Hello
+  - name: double
+    type: twice
+  - name: greet
+    type: jq
+    path: '"{{ context "greeting" }}, " + .'
+    as_raw: true
+  - name: results
+    type: collect
+`), 0o644))
+
+	p := &Pipeline{}
+	assert.NoError(t, config.Load(path, p))
+	assert.NoError(t, p.Run(context.Background()))
+
+	results, found := p.Task("results")
+	assert.True(t, found)
+	var data []string
+	for _, r := range results.(task.Collector).Records() {
+		data = append(data, string(r.Data))
+	}
+	assert.Equal(t, []string{`Hello, Ada`, `Hello, Ada`, `Bye, double done`}, data)
+}
+
+// Test that a plugin writing a stderr line too long to log does not block on
+// stderr, and its replies still come through
+func TestRunExecPluginLongStderr(t *testing.T) {
+	path := filepath.Join(t.TempDir(), `pipeline.yaml`)
+	assert.NoError(t, os.WriteFile(path, []byte(`
+plugins:
+  - type: noisy
+    command: sh
+    args:
+      - -c
+      - |
+        head -c 2000000 /dev/zero | tr "\0" x >&2
+        echo >&2
+        head -c 200000 /dev/zero | tr "\0" y >&2
+        while IFS= read -r line; do
+          printf '{"records":[%s]}\n' "$line"
+        done
+tasks:
+  - name: source
+    type: memory
+    records:
+      - data: Ada
+  - name: noise
+    type: noisy
+  - name: results
+    type: collect
+`), 0o644))
+
+	p := &Pipeline{}
+	assert.NoError(t, config.Load(path, p))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Run(context.Background())
+	}()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline did not terminate")
+	}
+
+	results, _ := p.Task("results")
+	records := results.(task.Collector).Records()
+	assert.Len(t, records, 1)
+	assert.Equal(t, "Ada", string(records[0].Data))
+}
+
+// Test that a command run per record passes its stderr and exit code on in the
+// context, and fails the run when it exits with a code not expected or times out
+func TestRunExec(t *testing.T) {
+	tests := []struct {
+		name     string
+		exec     string
+		expected []string
+		err      string
+	}{
+		{
+			name: "Expected exit code",
+			exec: `
+    args: [-c, 'echo "$(cat) failed" >&2; exit 3', '{{ context "name" }}']
+    expected_exit_codes: 0,3`,
+			expected: []string{`Ada failed (3)`},
+		},
+		{
+			name: "Unexpected exit code",
+			exec: `
+    args: [-c, 'echo "$(cat) failed" >&2; exit 3']`,
+			err: "command sh exited with code 3: Ada failed",
+		},
+		{
+			name: "Timeout",
+			exec: `
+    args: [-c, 'exec sleep 2']
+    timeout: 50ms`,
+			err: "command sh timed out after 50ms",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), `pipeline.yaml`)
+			assert.NoError(t, os.WriteFile(path, []byte(`
+tasks:
+  - name: source
+    type: memory
+    records:
+      - data: Ada
+        context:
+          name: Ada
+  - name: run
+    type: exec
+    command: sh
+    fail_on_error: true`+tt.exec+`
+  - name: describe
+    type: jq
+    path: '"{{ context "exec-stderr" }} ({{ context "exec-exit-code" }})"'
+    as_raw: true
+  - name: results
+    type: collect
+`), 0o644))
+
+			p := &Pipeline{}
+			assert.NoError(t, config.Load(path, p))
+			err := p.Run(context.Background())
+			if tt.err != `` {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+
+			results, _ := p.Task("results")
+			var data []string
+			for _, r := range results.(task.Collector).Records() {
+				data = append(data, string(r.Data))
+			}
+			assert.Equal(t, tt.expected, data)
+		})
+	}
+}
+
+// Test that a streaming command writing a stderr line too long to log does not
+// block on stderr, and its output still comes through
+func TestRunExecLongStderr(t *testing.T) {
+	path := filepath.Join(t.TempDir(), `pipeline.yaml`)
+	assert.NoError(t, os.WriteFile(path, []byte(`
+tasks:
+  - name: source
+    type: memory
+    records:
+      - data: Ada
+  - name: run
+    type: exec
+    command: sh
+    mode: stream
+    args: [-c, 'head -c 200000 /dev/zero | tr "\0" x >&2; echo >&2; head -c 200000 /dev/zero | tr "\0" y >&2; cat']
+  - name: results
+    type: collect
+`), 0o644))
+
+	p := &Pipeline{}
+	assert.NoError(t, config.Load(path, p))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Run(context.Background())
+	}()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline did not terminate")
+	}
+
+	results, _ := p.Task("results")
+	records := results.(task.Collector).Records()
+	assert.Len(t, records, 1)
+	assert.Equal(t, "Ada", string(records[0].Data))
+}
+
+// Test that a script is checked as it loads, and stopped when it runs too long
+func TestRunScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		loadErr string
+		runErr  string
+	}{
+		{
+			name:    "No process function",
+			script:  "\n        x = 1",
+			loadErr: "the script must define a function process(data, context)",
+		},
+		{
+			name: "Too many steps",
+			script: `
+        def process(data, context):
+            while True:
+                pass`,
+			runErr: "too many steps",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Pipeline{}
+			err := yaml.Unmarshal([]byte(`
+tasks:
+  - name: source
+    type: values
+    values: [Ada]
+  - name: run
+    type: script
+    fail_on_error: true
+    max_steps: 1000
+    script: |`+tt.script+`
+`), p)
+			if tt.loadErr != `` {
+				assert.ErrorContains(t, err, tt.loadErr)
+				return
+			}
+			assert.NoError(t, err)
+
+			err = p.Run(context.Background())
+			if tt.runErr != `` {
+				assert.ErrorContains(t, err, tt.runErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+// Test that next_page gets the page counter as $page_id, and still as the
+// second input when it reads inputs
+func TestRunPaginates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"page":%q}`, r.URL.Query().Get(`page`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		nextPage string
+	}{
+		{
+			name:     "Variable",
+			nextPage: `if $page_id <= 3 then "` + server.URL + `?page=" + ($page_id | tostring) else empty end`,
+		},
+		{
+			name:     "Inputs",
+			nextPage: `[inputs] as $input | $input[1].page_id as $page | if $page <= 3 then "` + server.URL + `?page=" + ($page | tostring) else empty end`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkpointPath := filepath.Join(t.TempDir(), "checkpoint.json")
+			p := &Pipeline{}
+			assert.NoError(t, yaml.Unmarshal([]byte(`
+checkpoint:
+  path: `+checkpointPath+`
+tasks:
+  - name: fetch
+    type: http
+    endpoint: `+server.URL+`?page=1
+    next_page: '`+tt.nextPage+`'
+  - name: results
+    type: collect
+`), p))
+			assert.NoError(t, p.Run(context.Background()))
+
+			results, found := p.Task("results")
+			assert.True(t, found)
+			var data []string
+			for _, r := range results.(task.Collector).Records() {
+				data = append(data, string(r.Data))
+			}
+			assert.Equal(t, []string{`{"page":"1"}`, `{"page":"2"}`, `{"page":"3"}`}, data)
+
+			// only the latest cursor is kept
+			saved, err := os.ReadFile(checkpointPath)
+			assert.NoError(t, err)
+			assert.JSONEq(t, `{"tasks":{"fetch":["{\"done\":true}"]}}`, string(saved))
+		})
+	}
+}
+
+// Test that records sharing a context do not see the values set on each other,
+// and that the context is serialized with the record
+func TestRecordContext(t *testing.T) {
+	r := &record.Record{Data: []byte("Ada")}
+	r.SetContextValue("greeting", "Hello")
+
+	shared := &record.Record{Data: []byte("Grace"), Context: r.Context}
+	shared.SetContextValue("greeting", "Dear")
+	shared.SetContextValue("title", "Rear Admiral")
+
+	greeting, found := r.GetContextValue("greeting")
+	assert.True(t, found)
+	assert.Equal(t, "Hello", greeting)
+	_, found = r.GetContextValue("title")
+	assert.False(t, found)
+	assert.Equal(t, map[string]string{"greeting": "Dear", "title": "Rear Admiral"}, shared.ContextValues())
+
+	assert.JSONEq(t, `{"data":"Ada","context":{"greeting":"Hello"}}`, string(r.Bytes()))
+}
+
+// Test that the context propagated to the next pipeline leaves out the keys
+// steering records within this one
+func TestPropagatedContext(t *testing.T) {
+	r := &record.Record{}
+	r.SetContextValue("user_id", "42")
+	r.SetContextValue(string(task.CtxKeyDeadLetterError), "bad record")
+	r.SetContextValue(string(task.CtxKeyRoute), "")
+	r.SetContextValue(string(task.CtxKeyFileNameWrite), "users.json")
+
+	assert.Equal(t, map[string]string{
+		"user_id":                          "42",
+		string(task.CtxKeyDeadLetterError): "bad record",
+	}, task.PropagatedContext(r))
+	_, found := r.GetContextValue(string(task.CtxKeyRoute))
+	assert.True(t, found)
+}
+
+// Test that every task exports a span per record, and that the spans of a record
+// share its trace, continuing one it came with
+func TestRunTraces(t *testing.T) {
+	const callerTrace = `4bf92f3577b34da6a3ce929d0e0e4736`
+
+	path := filepath.Join(t.TempDir(), `pipeline.yaml`)
+	assert.NoError(t, os.WriteFile(path, []byte(`
+tracing:
+  exporter: stdout
+tasks:
+  - name: source
+    type: memory
+    records:
+      - data: Ada
+      - data: Grace
+        context:
+          traceparent: 00-`+callerTrace+`-00f067aa0ba902b7-01
+  - name: greet
+    type: jq
+    path: '"Hello, " + .'
+  - name: results
+    type: collect
+`), 0o644))
+
+	p := &Pipeline{}
+	spans := exportSpans(t, func() {
+		assert.NoError(t, config.Load(path, p))
+		assert.NoError(t, p.Run(context.Background()))
+	})
+
+	// the source starts a trace for Ada, and Grace goes on with the trace of its caller
+	traces := make(map[string][]string)
+	for _, s := range spans {
+		traces[s.SpanContext.TraceID] = append(traces[s.SpanContext.TraceID], s.Name)
+	}
+	assert.Len(t, traces, 2)
+	assert.ElementsMatch(t, []string{"greet", "results"}, traces[callerTrace])
+	for traceID, names := range traces {
+		if traceID != callerTrace {
+			assert.ElementsMatch(t, []string{"source", "greet", "results"}, names)
+		}
+	}
+
+	results, found := p.Task("results")
+	assert.True(t, found)
+	for _, r := range results.(task.Collector).Records() {
+		traceParent, found := r.GetContextValue(string(task.CtxKeyTraceParent))
+		assert.True(t, found)
+		assert.Len(t, traceParent, 55)
+	}
+}
+
+// Test that the span of a task on a record ends when its worker asks for the
+// next record, not when the next one arrives from a slow source
+func TestRunTracesExcludeIdleInput(t *testing.T) {
+	const gap = 50 * time.Millisecond
+
+	p := &Pipeline{
+		Tracing: &tracing.Tracing{Exporter: "stdout"},
+		Tasks: tasks{
+			&counter{Base: task.Base{Name: "source"}, count: 3, gap: gap},
+			&collector{Base: task.Base{Name: "sink"}},
+		},
+	}
+	spans := exportSpans(t, func() {
+		assert.NoError(t, p.Init())
+		assert.NoError(t, p.Run(context.Background()))
+	})
+
+	sinkSpans := 0
+	for _, s := range spans {
+		if s.Name == "sink" {
+			sinkSpans++
+			assert.Less(t, s.EndTime.Sub(s.StartTime), gap)
+		}
+	}
+	assert.Equal(t, 3, sinkSpans)
+}
+
+// exportedSpan is a span as the stdout exporter writes it
+type exportedSpan struct {
+	Name        string
+	SpanContext struct{ TraceID, SpanID string }
+	Parent      struct{ TraceID, SpanID string }
+	StartTime   time.Time
+	EndTime     time.Time
+}
+
+// exportSpans returns the spans exported to stdout while run initializes and
+// runs a pipeline
+func exportSpans(t *testing.T, run func()) []exportedSpan {
+	reader, writer, err := os.Pipe()
+	assert.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() { os.Stdout = stdout }()
+
+	exported := make(chan []exportedSpan)
+	go func() {
+		var spans []exportedSpan
+		decoder := json.NewDecoder(reader)
+		for {
+			var s exportedSpan
+			if err := decoder.Decode(&s); err != nil {
+				break
+			}
+			spans = append(spans, s)
+		}
+		exported <- spans
+	}()
+
+	run()
+	assert.NoError(t, writer.Close())
+
+	return <-exported
+}
+
+// Test that a file is checkpointed once its records went through every task, so
+// a run failing halfway resumes with the files it did not write
+func TestRunCommitsCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644))
+	}
+	checkpointPath := filepath.Join(dir, "checkpoint.json")
+
+	run := func(query string, resume bool) ([]string, error) {
+		path := filepath.Join(dir, "pipeline.yaml")
+		assert.NoError(t, os.WriteFile(path, []byte(`
+checkpoint:
+  path: `+checkpointPath+`
+  resume: `+fmt.Sprint(resume)+`
+tasks:
+  - name: read
+    type: file
+    path: `+filepath.Join(dir, "*.txt")+`
+  - name: transform
+    type: jq
+    path: '`+query+`'
+    ignore_error: false
+    fail_on_error: true
+  - name: results
+    type: collect
+`), 0o644))
+
+		p := &Pipeline{}
+		assert.NoError(t, config.Load(path, p))
+		err := p.Run(context.Background())
+
+		results, _ := p.Task("results")
+		var data []string
+		for _, r := range results.(task.Collector).Records() {
+			data = append(data, string(r.Data))
+		}
+		return data, err
+	}
+
+	data, err := run(`if . == "b.txt" then error("bad record") else . end`, false)
+	assert.Error(t, err)
+	assert.Equal(t, []string{`"a.txt"`}, data)
+
+	saved, err := os.ReadFile(checkpointPath)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"tasks":{"read":["`+filepath.Join(dir, "a.txt")+`"]}}`, string(saved))
+
+	data, err = run(`.`, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`"b.txt"`, `"c.txt"`}, data)
+
+	saved, err = os.ReadFile(checkpointPath)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"tasks":{"read":["`+filepath.Join(dir, "a.txt")+`","`+filepath.Join(dir, "b.txt")+`","`+filepath.Join(dir, "c.txt")+`"]}}`, string(saved))
+}
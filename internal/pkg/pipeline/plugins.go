@@ -0,0 +1,46 @@
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+)
+
+// validatePlugins checks that the plugins of the pipeline are complete, and that
+// their types are new
+func (p *Pipeline) validatePlugins() error {
+
+	types := make(map[string]bool, len(p.Plugins))
+	for i, plugin := range p.Plugins {
+		if plugin == nil {
+			return fmt.Errorf("plugin %d must not be empty", i+1)
+		}
+		if err := validate.Struct(plugin); err != nil {
+			return fmt.Errorf("plugin %d: %w", i+1, err)
+		}
+		if _, found := taskConstructor(plugin.Type); found {
+			return fmt.Errorf("plugin %s: task type is already supported", plugin.Type)
+		}
+		if types[plugin.Type] {
+			return fmt.Errorf("plugin %s is defined more than once", plugin.Type)
+		}
+		types[plugin.Type] = true
+	}
+
+	return nil
+
+}
+
+// taskConstructor returns the constructor of a task type: one of the plugins of
+// the pipeline, or a supported type
+func (p *Pipeline) taskConstructor(taskType string) (func() (task.Task, error), bool) {
+
+	for _, plugin := range p.Plugins {
+		if plugin != nil && plugin.Type == taskType {
+			return plugin.New, true
+		}
+	}
+
+	return taskConstructor(taskType)
+
+}
@@ -0,0 +1,152 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/patterninc/caterpillar/internal/pkg/checkpoint"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+)
+
+// portHub runs a task the dag wires by port once, however many times the dag
+// names it: the inputs of every occurrence are merged into the task, and its
+// output is dispatched to the occurrences by port
+type portHub struct {
+	task        task.Task
+	inputs      []<-chan *record.Record
+	subscribers map[string][]chan *record.Record // by port, "" for the task named without one
+	checkpoint  *checkpoint.Checkpoint           // told about the records dispatched to several or no subscribers
+}
+
+// validatePorts checks that every task.port in the dag names a port of the task
+func (p *Pipeline) validatePorts() error {
+
+	for _, dag := range []*DAG{p.DAG, p.DeadLetter} {
+		if dag == nil {
+			continue
+		}
+		for _, name := range dag.portNames() {
+			taskName, port := splitPort(name)
+			t, found := p.taskByName[taskName]
+			if !found {
+				return fmt.Errorf("task not found: %s", taskName)
+			}
+			ported, ok := t.(task.Ported)
+			if !ok || !slices.Contains(ported.Ports(), port) {
+				return fmt.Errorf("task %s has no output port %s", taskName, port)
+			}
+		}
+	}
+
+	return nil
+
+}
+
+// portHubs returns a hub for every task the dags wire by port
+func (p *Pipeline) portHubs() map[string]*portHub {
+
+	hubs := make(map[string]*portHub)
+	for _, dag := range []*DAG{p.DAG, p.DeadLetter} {
+		if dag == nil {
+			continue
+		}
+		for _, name := range dag.portNames() {
+			taskName, _ := splitPort(name)
+			if _, found := hubs[taskName]; !found {
+				hubs[taskName] = &portHub{
+					task:        p.taskByName[taskName],
+					subscribers: make(map[string][]chan *record.Record),
+					checkpoint:  p.Checkpoint,
+				}
+			}
+		}
+	}
+
+	return hubs
+
+}
+
+// add wires one occurrence of the task and returns the channel it receives the
+// records of port on, or nil when nothing follows it
+func (h *portHub) add(port string, input <-chan *record.Record, isLeaf bool, channelSize int) <-chan *record.Record {
+
+	if input != nil {
+		h.inputs = append(h.inputs, input)
+	}
+	if isLeaf {
+		return nil
+	}
+
+	output := make(chan *record.Record, channelSize)
+	h.subscribers[port] = append(h.subscribers[port], output)
+
+	return output
+
+}
+
+// startHubs runs the tasks wired by port, once every occurrence has been added
+func (p *Pipeline) startHubs(ctx context.Context) {
+
+	for _, hub := range p.hubs {
+		var input <-chan *record.Record
+		switch len(hub.inputs) {
+		case 0:
+		case 1:
+			input = hub.inputs[0]
+		default:
+			input = p.mergeChannels(hub.inputs)
+		}
+
+		var output chan *record.Record
+		if len(hub.subscribers) > 0 {
+			output = make(chan *record.Record, p.ChannelSize)
+			go hub.dispatch(output)
+		}
+
+		p.runTaskConcurrently(ctx, hub.task, input, output)
+	}
+
+}
+
+// dispatch sends each record to the occurrences wired to its port, or to those
+// named without a port when its port is not wired; the port is cleared so it
+// does not apply to a task further down
+func (h *portHub) dispatch(output <-chan *record.Record) {
+
+	defer func() {
+		for _, subscribers := range h.subscribers {
+			for _, ch := range subscribers {
+				close(ch)
+			}
+		}
+	}()
+
+	for rec := range output {
+		port, _ := rec.GetContextValue(string(task.CtxKeyPort))
+		subscribers, found := h.subscribers[port]
+		if !found {
+			subscribers = h.subscribers[""]
+		}
+		if port != "" {
+			rec.SetContextValue(string(task.CtxKeyPort), "")
+		}
+		if len(subscribers) == 0 {
+			h.checkpoint.Dropped(rec)
+			continue
+		}
+		h.checkpoint.Forked(rec, len(subscribers)-1)
+		// every subscriber gets a record of its own, so tasks setting context on it do
+		// not race; the last one gets rec itself, once every copy of it is made
+		for i, ch := range subscribers {
+			if i == len(subscribers)-1 {
+				ch <- rec
+				continue
+			}
+			subscriberRecord := *rec
+			ch <- &subscriberRecord
+		}
+	}
+
+}
@@ -1,27 +1,28 @@
 package record
 
 import (
-	"context"
+	"maps"
 )
 
-type contextKey string
+// Metadata holds the context values of a record by key. Records sent from
+// another record share its metadata, so setting a value copies it first.
+type Metadata map[string]string
 
 func (r *Record) SetContextValue(key string, value string) {
-	if r.Context == nil {
-		r.Context = context.Background()
+	values := maps.Clone(r.Context)
+	if values == nil {
+		values = make(Metadata, 1)
 	}
-	r.Context = context.WithValue(r.Context, contextKey(key), string(value))
+	values[key] = value
+	r.Context = values
 }
 
 func (r *Record) GetContextValue(key string) (string, bool) {
+	value, found := r.Context[key]
+	return value, found
+}
 
-	if ctx := r.Context; ctx != nil {
-		if v := ctx.Value(contextKey(key)); v != nil {
-			vString, ok := v.(string)
-			return vString, ok
-		}
-	}
-
-	return ``, false
-
+// ContextValues returns a copy of the context values of the record by key
+func (r *Record) ContextValues() map[string]string {
+	return maps.Clone(r.Context)
 }
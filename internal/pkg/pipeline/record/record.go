@@ -1,15 +1,14 @@
 package record
 
 import (
-	"context"
 	"encoding/json"
 )
 
 type Record struct {
-	ID      int             `yaml:"id,omitempty" json:"id,omitempty"`
-	Origin  string          `yaml:"origin,omitempty" json:"origin,omitempty"`
-	Data    []byte          `yaml:"data,omitempty" json:"data,omitempty"`
-	Context context.Context `yaml:"-" json:"-"`
+	ID      int      `yaml:"id,omitempty" json:"id,omitempty"`
+	Origin  string   `yaml:"origin,omitempty" json:"origin,omitempty"`
+	Data    []byte   `yaml:"data,omitempty" json:"data,omitempty"`
+	Context Metadata `yaml:"context,omitempty" json:"context,omitempty"`
 }
 
 func (m Record) MarshalJSON() ([]byte, error) {
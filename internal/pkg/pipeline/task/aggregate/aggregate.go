@@ -0,0 +1,279 @@
+package aggregate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/patterninc/caterpillar/internal/pkg/duration"
+	"github.com/patterninc/caterpillar/internal/pkg/jq"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+)
+
+// fields the task adds to every emitted record
+const (
+	keyField         = `key`
+	windowStartField = `window_start`
+	windowEndField   = `window_end`
+)
+
+var (
+	ErrIncorrectInputOutput = fmt.Errorf(`input and output channels must be provided`)
+)
+
+type aggregate struct {
+	task.Base `yaml:",inline" json:",inline"`
+	GroupBy   *jq.Query           `yaml:"group_by,omitempty" json:"group_by,omitempty"`
+	Reducers  map[string]*reducer `yaml:"reducers,omitempty" json:"reducers,omitempty" validate:"required,min=1,dive"`
+	Window    duration.Duration   `yaml:"window,omitempty" json:"window,omitempty"`
+	Slide     duration.Duration   `yaml:"slide,omitempty" json:"slide,omitempty"`
+}
+
+// pane holds the groups seen during one slide (or one whole window) of time
+type pane struct {
+	start  time.Time
+	groups map[string]*group
+	order  []string // group keys in order of first appearance
+}
+
+type group struct {
+	key          any
+	accumulators map[string]*accumulator
+}
+
+func New() (task.Task, error) {
+	return &aggregate{}, nil
+}
+
+func (a *aggregate) Init() error {
+
+	// workers would each aggregate their own share of the records
+	if a.TaskConcurrency > 1 {
+		return fmt.Errorf("aggregate task does not support task_concurrency greater than 1")
+	}
+
+	for name, r := range a.Reducers {
+		switch name {
+		case keyField, windowStartField, windowEndField:
+			return fmt.Errorf("reducer name %s is reserved", name)
+		}
+		if r.Op != opCount && r.Value == nil {
+			return fmt.Errorf("reducer %s: value is required for %s", name, r.Op)
+		}
+	}
+
+	if a.Window < 0 || a.Slide < 0 {
+		return fmt.Errorf("window and slide must not be negative")
+	}
+	if a.Slide > 0 {
+		if a.Window == 0 {
+			return fmt.Errorf("slide requires a window")
+		}
+		if a.Slide > a.Window || a.Window%a.Slide != 0 {
+			return fmt.Errorf("window must be a multiple of slide")
+		}
+	}
+
+	return nil
+
+}
+
+// Positions returns where the task can run: it needs both input and output
+func (a *aggregate) Positions() task.Position {
+	return task.PositionMiddle
+}
+
+func (a *aggregate) Run(_ context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
+
+	if input == nil || output == nil {
+		return ErrIncorrectInputOutput
+	}
+
+	// read input on its own goroutine, so windows close on time even when no
+	// records arrive
+	records, done := make(chan *record.Record), make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(records)
+		for {
+			r, ok := a.GetRecord(input)
+			if !ok {
+				return
+			}
+			select {
+			case records <- r:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// a tumbling window is a sliding window of a single pane
+	interval, panesPerWindow := time.Duration(a.Window), 1
+	if a.Slide > 0 {
+		interval, panesPerWindow = time.Duration(a.Slide), int(a.Window/a.Slide)
+	}
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	current := newPane(time.Now())
+	panes := make([]*pane, 0, panesPerWindow)
+
+	for {
+		select {
+		case r, ok := <-records:
+			if !ok {
+				// emit what is left, unless the last window already covered it
+				if len(current.order) == 0 {
+					return nil
+				}
+				panes = appendPane(panes, current, panesPerWindow)
+				return a.emit(panes, time.Now(), output)
+			}
+			if err := a.add(current, r); err != nil {
+				if a.DeadLetter(r, err) {
+					continue
+				}
+				return err
+			}
+		case now := <-tick:
+			panes = appendPane(panes, current, panesPerWindow)
+			if err := a.emit(panes, now, output); err != nil {
+				return err
+			}
+			current = newPane(now)
+		}
+	}
+
+}
+
+// add folds a record into the group its key selects
+func (a *aggregate) add(p *pane, rc *record.Record) error {
+
+	var keyValue any
+	if a.GroupBy != nil {
+		value, err := a.GroupBy.Execute(rc.Data)
+		if err != nil {
+			return fmt.Errorf("group_by: %w", err)
+		}
+		keyValue = value
+	}
+
+	key, err := json.Marshal(keyValue)
+	if err != nil {
+		return err
+	}
+
+	// evaluate every reducer before touching the group, so a failing record
+	// leaves no partial state behind
+	values := make(map[string]any, len(a.Reducers))
+	for name, r := range a.Reducers {
+		if r.Value == nil {
+			continue
+		}
+		value, err := r.Value.Execute(rc.Data)
+		if err != nil {
+			return fmt.Errorf("reducer %s: %w", name, err)
+		}
+		values[name] = value
+	}
+
+	g := p.group(string(key), keyValue, a.Reducers)
+	for name, r := range a.Reducers {
+		if err := r.add(g.accumulators[name], values[name]); err != nil {
+			return fmt.Errorf("reducer %s: %w", name, err)
+		}
+	}
+
+	return nil
+
+}
+
+// emit merges panes into a single window and sends one record per group
+func (a *aggregate) emit(panes []*pane, end time.Time, output chan<- *record.Record) error {
+
+	window := newPane(panes[0].start)
+	for _, p := range panes {
+		for _, key := range p.order {
+			source := p.groups[key]
+			g := window.group(key, source.key, a.Reducers)
+			for name, r := range a.Reducers {
+				if err := r.merge(g.accumulators[name], source.accumulators[name]); err != nil {
+					return fmt.Errorf("reducer %s: %w", name, err)
+				}
+			}
+		}
+	}
+
+	for _, key := range window.order {
+		g := window.groups[key]
+
+		result := make(map[string]any, len(a.Reducers)+3)
+		if a.GroupBy != nil {
+			result[keyField] = g.key
+		}
+		if a.Window > 0 {
+			result[windowStartField] = window.start.UTC().Format(time.RFC3339Nano)
+			result[windowEndField] = end.UTC().Format(time.RFC3339Nano)
+		}
+		for name, r := range a.Reducers {
+			result[name] = r.result(g.accumulators[name])
+		}
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+
+		a.SendData(nil, data, output)
+	}
+
+	return nil
+
+}
+
+func newPane(start time.Time) *pane {
+	return &pane{
+		start:  start,
+		groups: make(map[string]*group),
+	}
+}
+
+// group returns the group for key, creating it on first use
+func (p *pane) group(key string, keyValue any, reducers map[string]*reducer) *group {
+
+	g, found := p.groups[key]
+	if !found {
+		g = &group{
+			key:          keyValue,
+			accumulators: make(map[string]*accumulator, len(reducers)),
+		}
+		for name := range reducers {
+			g.accumulators[name] = &accumulator{}
+		}
+		p.groups[key] = g
+		p.order = append(p.order, key)
+	}
+
+	return g
+
+}
+
+// appendPane adds p to the window, dropping panes that have slid out of it
+func appendPane(panes []*pane, p *pane, size int) []*pane {
+
+	panes = append(panes, p)
+	if len(panes) > size {
+		panes = panes[len(panes)-size:]
+	}
+
+	return panes
+
+}
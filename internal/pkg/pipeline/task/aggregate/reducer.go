@@ -0,0 +1,185 @@
+package aggregate
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/patterninc/caterpillar/internal/pkg/jq"
+)
+
+// reducer ops
+const (
+	opCount   = `count`
+	opSum     = `sum`
+	opMin     = `min`
+	opMax     = `max`
+	opAvg     = `avg`
+	opCollect = `collect`
+	opFirst   = `first`
+	opLast    = `last`
+)
+
+type reducer struct {
+	Op    string    `yaml:"op,omitempty" json:"op,omitempty" validate:"required,oneof=count sum min max avg collect first last"`
+	Value *jq.Query `yaml:"value,omitempty" json:"value,omitempty"`
+}
+
+// accumulator holds the running state of one reducer for one group. Accumulators
+// of the same reducer can be merged, which is how sliding windows combine panes.
+type accumulator struct {
+	seen   bool
+	count  int
+	sum    float64
+	value  any // min, max, first or last
+	values []any
+}
+
+// add folds the value of a single record into acc; a null value is skipped, as
+// in SQL, except by count without a value which counts every record
+func (r *reducer) add(acc *accumulator, value any) error {
+
+	if r.Op == opCount && r.Value == nil {
+		acc.count++
+		return nil
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	switch r.Op {
+	case opCount:
+		acc.count++
+	case opSum, opAvg:
+		number, err := toFloat(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", r.Op, err)
+		}
+		acc.count++
+		acc.sum += number
+	case opMin, opMax:
+		if acc.seen {
+			less, err := compare(value, acc.value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", r.Op, err)
+			}
+			if (r.Op == opMin) != less {
+				break
+			}
+		}
+		acc.value = value
+	case opCollect:
+		acc.values = append(acc.values, value)
+	case opFirst:
+		if !acc.seen {
+			acc.value = value
+		}
+	case opLast:
+		acc.value = value
+	}
+
+	acc.seen = true
+
+	return nil
+
+}
+
+// merge folds other, which holds later records, into acc
+func (r *reducer) merge(acc, other *accumulator) error {
+
+	if !other.seen && other.count == 0 {
+		return nil
+	}
+
+	acc.count += other.count
+	acc.sum += other.sum
+	acc.values = append(acc.values, other.values...)
+
+	switch r.Op {
+	case opMin, opMax:
+		if acc.seen {
+			less, err := compare(other.value, acc.value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", r.Op, err)
+			}
+			if (r.Op == opMin) != less {
+				break
+			}
+		}
+		acc.value = other.value
+	case opFirst:
+		if !acc.seen {
+			acc.value = other.value
+		}
+	case opLast:
+		acc.value = other.value
+	}
+
+	acc.seen = acc.seen || other.seen
+
+	return nil
+
+}
+
+func (r *reducer) result(acc *accumulator) any {
+
+	switch r.Op {
+	case opCount:
+		return acc.count
+	case opSum:
+		return acc.sum
+	case opAvg:
+		if acc.count == 0 {
+			return nil
+		}
+		return acc.sum / float64(acc.count)
+	case opCollect:
+		if acc.values == nil {
+			return []any{}
+		}
+		return acc.values
+	default:
+		return acc.value
+	}
+
+}
+
+func toFloat(value any) (float64, error) {
+
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f, nil
+	default:
+		return 0, fmt.Errorf("value is not a number: %v", value)
+	}
+
+}
+
+// compare reports whether a sorts before b; numbers and strings are supported
+func compare(a, b any) (bool, error) {
+
+	if as, ok := a.(string); ok {
+		bs, ok := b.(string)
+		if !ok {
+			return false, fmt.Errorf("cannot compare %v with %v", a, b)
+		}
+		return as < bs, nil
+	}
+
+	af, err := toFloat(a)
+	if err != nil {
+		return false, err
+	}
+	bf, err := toFloat(b)
+	if err != nil {
+		return false, fmt.Errorf("cannot compare %v with %v", a, b)
+	}
+
+	return af < bf, nil
+
+}
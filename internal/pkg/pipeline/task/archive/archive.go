@@ -1,6 +1,7 @@
 package archive
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
@@ -20,8 +21,8 @@ const (
 )
 
 type archiver interface {
-	Read()
-	Write()
+	Read() error
+	Write() error
 }
 
 type channelStruct struct {
@@ -45,9 +46,9 @@ var (
 		},
 	}
 
-	supportedActions = map[string]func(archiver) func(){
-		`pack`:   func(a archiver) func() { return a.Write },
-		`unpack`: func(a archiver) func() { return a.Read },
+	supportedActions = map[string]func(archiver) func() error{
+		`pack`:   func(a archiver) func() error { return a.Write },
+		`unpack`: func(a archiver) func() error { return a.Read },
 	}
 )
 
@@ -66,11 +67,10 @@ func New() (task.Task, error) {
 
 func (c *core) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	type raw core
-	obj := raw{
-		Format: defaultFormat,
-		Action: defaultAction,
-	}
-	if err := unmarshal(&obj); err != nil {
+	obj := (*raw)(c) // decode in place, core embeds a mutex and must not be copied
+	obj.Format = defaultFormat
+	obj.Action = defaultAction
+	if err := unmarshal(obj); err != nil {
 		return err
 	}
 
@@ -78,12 +78,20 @@ func (c *core) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		return fmt.Errorf("invalid action: %s (must be 'pack' or 'unpack')", obj.Action)
 	}
 
-	*c = core(obj)
-
 	return nil
 }
 
-func (c *core) Run(input <-chan *record.Record, output chan<- *record.Record) (err error) {
+// Positions returns where the task can run: it needs input
+func (c *core) Positions() task.Position {
+	return task.PositionMiddle | task.PositionLast
+}
+
+// ContextKeys returns the context keys set on the records of unpacked files
+func (c *core) ContextKeys() []string {
+	return []string{string(task.CtxKeyArchiveFileNameWrite)}
+}
+
+func (c *core) Run(_ context.Context, input <-chan *record.Record, output chan<- *record.Record) (err error) {
 
 	if input == nil {
 		return task.ErrNilInput
@@ -97,7 +105,6 @@ func (c *core) Run(input <-chan *record.Record, output chan<- *record.Record) (e
 	})
 
 	actionFunc := supportedActions[string(c.Action)](archiv)
-	actionFunc()
 
-	return nil
+	return actionFunc()
 }
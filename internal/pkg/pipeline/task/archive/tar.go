@@ -3,8 +3,8 @@ package archive
 import (
 	"archive/tar"
 	"bytes"
+	"fmt"
 	"io"
-	"log"
 	"path/filepath"
 	"strings"
 
@@ -18,7 +18,7 @@ type tarArchive struct {
 	*channelStruct
 }
 
-func (t *tarArchive) Read() {
+func (t *tarArchive) Read() error {
 
 	for {
 		rc, ok := t.GetRecord(t.InputChan)
@@ -40,14 +40,14 @@ func (t *tarArchive) Read() {
 				break
 			}
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 
 			// check the file type is regular file
 			if header.Typeflag == tar.TypeReg {
 				buf := make([]byte, header.Size)
 				if _, err := io.ReadFull(r, buf); err != nil && err != io.EOF {
-					log.Fatal(err)
+					return err
 				}
 				rc.SetContextValue(string(task.CtxKeyArchiveFileNameWrite), textutil.SlugifyFileName(filepath.Base(header.Name)))
 				t.SendData(rc.Context, buf, t.OutputChan)
@@ -55,9 +55,12 @@ func (t *tarArchive) Read() {
 
 		}
 	}
+
+	return nil
+
 }
 
-func (t *tarArchive) Write() {
+func (t *tarArchive) Write() error {
 
 	var buf bytes.Buffer
 	tw := tar.NewWriter(&buf)
@@ -76,11 +79,11 @@ func (t *tarArchive) Write() {
 
 		filePath, found := rec.GetContextValue(string(task.CtxKeyFileNameWrite))
 		if !found {
-			log.Fatal("filepath not set in context")
+			return fmt.Errorf("filepath not set in context")
 		}
 
 		if filePath == "" {
-			log.Fatal("empty filepath in context")
+			return fmt.Errorf("empty filepath in context")
 		}
 
 		filePath = strings.ReplaceAll(filePath, "\\", "/")
@@ -91,19 +94,22 @@ func (t *tarArchive) Write() {
 			Size: int64(len(b)),
 		}
 		if err := tw.WriteHeader(header); err != nil {
-			log.Fatal(err)
+			return err
 		}
 
 		if _, err := tw.Write(b); err != nil {
-			log.Fatal(err)
+			return err
 		}
 
 		rc.Context = rec.Context
 	}
 
 	if err := tw.Close(); err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	t.SendData(rc.Context, buf.Bytes(), t.OutputChan)
+
+	return nil
+
 }
@@ -3,8 +3,8 @@ package archive
 import (
 	"archive/zip"
 	"bytes"
+	"fmt"
 	"io"
-	"log"
 	"path/filepath"
 	"strings"
 
@@ -18,7 +18,7 @@ type zipArchive struct {
 	*channelStruct
 }
 
-func (z *zipArchive) Read() {
+func (z *zipArchive) Read() error {
 	for {
 		rc, ok := z.GetRecord(z.InputChan)
 		if !ok {
@@ -33,7 +33,7 @@ func (z *zipArchive) Read() {
 
 		r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 		for _, f := range r.File {
 
@@ -44,7 +44,7 @@ func (z *zipArchive) Read() {
 
 				fs, err := f.Open()
 				if err != nil {
-					log.Fatal(err)
+					return err
 				}
 
 				buf := make([]byte, f.FileInfo().Size())
@@ -52,16 +52,19 @@ func (z *zipArchive) Read() {
 				_, err = io.ReadFull(fs, buf)
 				fs.Close()
 				if err != nil && err != io.EOF {
-					log.Fatal(err)
+					return err
 				}
 
 				z.SendData(rc.Context, buf, z.OutputChan)
 			}
 		}
 	}
+
+	return nil
+
 }
 
-func (z *zipArchive) Write() {
+func (z *zipArchive) Write() error {
 
 	zipBuf := new(bytes.Buffer)
 	zipWriter := zip.NewWriter(zipBuf)
@@ -75,32 +78,34 @@ func (z *zipArchive) Write() {
 
 		filePath, found := rec.GetContextValue(string(task.CtxKeyFileNameWrite))
 		if !found {
-			log.Fatal("filepath not set in context")
+			return fmt.Errorf("filepath not set in context")
 		}
 
 		if filePath == "" {
-			log.Fatal("empty filepath in context")
+			return fmt.Errorf("empty filepath in context")
 		}
 
 		filePath = strings.ReplaceAll(filePath, "\\", "/")
 
 		w, err := zipWriter.Create(filePath)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 		_, err = w.Write(rec.Data)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
 		rc.Context = rec.Context
 	}
 
 	if err := zipWriter.Close(); err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	// Send the complete ZIP archive
 	z.SendData(rc.Context, zipBuf.Bytes(), z.OutputChan)
 
+	return nil
+
 }
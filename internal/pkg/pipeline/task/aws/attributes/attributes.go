@@ -0,0 +1,61 @@
+package attributes
+
+import (
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// MaxCount is the number of message attributes SQS and SNS take at most
+const MaxCount = 10
+
+const maxNameLength = 256
+
+var (
+	namePattern      = regexp.MustCompile(`^[A-Za-z0-9_\-.]+$`)
+	reservedPrefixes = []string{`aws.`, `amazon.`}
+)
+
+// ValidName reports whether SQS and SNS take name as a message attribute name: up
+// to 256 letters, digits, underscores, hyphens and periods, without a leading,
+// trailing or repeated period and without the reserved AWS. and Amazon. prefixes
+func ValidName(name string) bool {
+
+	if len(name) > maxNameLength || !namePattern.MatchString(name) {
+		return false
+	}
+	if strings.HasPrefix(name, `.`) || strings.HasSuffix(name, `.`) || strings.Contains(name, `..`) {
+		return false
+	}
+
+	lower := strings.ToLower(name)
+	for _, prefix := range reservedPrefixes {
+		if strings.HasPrefix(lower, prefix) {
+			return false
+		}
+	}
+
+	return true
+
+}
+
+// Select returns the names of values that can go as message attributes, sorted:
+// those with a value and a valid name, up to limit. The names left out for being
+// invalid or over the limit are returned as dropped; empty values are skipped
+// quietly, as SQS and SNS do not take them.
+func Select(values map[string]string, limit int) (names, dropped []string) {
+
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		switch {
+		case values[name] == ``:
+		case !ValidName(name) || len(names) >= limit:
+			dropped = append(dropped, name)
+		default:
+			names = append(names, name)
+		}
+	}
+
+	return names, dropped
+
+}
@@ -0,0 +1,90 @@
+package attributes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that only the names SQS and SNS take are valid
+func TestValidName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{name: "user_id", expected: true},
+		{name: "Trace-Parent.v1", expected: true},
+		{name: strings.Repeat("a", 256), expected: true},
+		{name: strings.Repeat("a", 257)},
+		{name: ""},
+		{name: "user id"},
+		{name: "user:id"},
+		{name: "naïve"},
+		{name: ".user"},
+		{name: "user."},
+		{name: "user..id"},
+		{name: "AWS.trace"},
+		{name: "aws.trace"},
+		{name: "Amazon.trace"},
+		{name: "AWSTrace", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ValidName(tt.name))
+		})
+	}
+}
+
+// Test that Select keeps valid names with a value, in order, up to the limit
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  map[string]string
+		limit   int
+		names   []string
+		dropped []string
+	}{
+		{
+			name:   "Valid names",
+			values: map[string]string{"b": "2", "a": "1"},
+			limit:  MaxCount,
+			names:  []string{"a", "b"},
+		},
+		{
+			name:   "Empty values skipped",
+			values: map[string]string{"a": "1", "b": ""},
+			limit:  MaxCount,
+			names:  []string{"a"},
+		},
+		{
+			name:    "Invalid names dropped",
+			values:  map[string]string{"a": "1", "AWS.b": "2", "c d": "3"},
+			limit:   MaxCount,
+			names:   []string{"a"},
+			dropped: []string{"AWS.b", "c d"},
+		},
+		{
+			name:    "Names over the limit dropped",
+			values:  map[string]string{"a": "1", "b": "2", "c": "3"},
+			limit:   2,
+			names:   []string{"a", "b"},
+			dropped: []string{"c"},
+		},
+		{
+			name:    "No room left",
+			values:  map[string]string{"a": "1"},
+			limit:   0,
+			dropped: []string{"a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names, dropped := Select(tt.values, tt.limit)
+			assert.Equal(t, tt.names, names)
+			assert.Equal(t, tt.dropped, dropped)
+		})
+	}
+}
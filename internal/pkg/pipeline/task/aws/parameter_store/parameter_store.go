@@ -71,13 +71,13 @@ func New() (task.Task, error) {
 
 func (p *parameterStore) GetTaskConcurrency() int {
 	if p.Base.TaskConcurrency > 1 {
-		fmt.Printf("WARN: task_concurrency (%d) is not supported for task '%s'. Only one ssm client instance will run.\n",
-			p.Base.TaskConcurrency, p.Base.Type)
+		p.Logger().Warn(`task_concurrency is not supported, only one ssm client instance will run`, `task_concurrency`, p.Base.TaskConcurrency)
 	}
 	return 1
 }
 
-func (p *parameterStore) Init() error {
+// Check validates the configuration without contacting AWS
+func (p *parameterStore) Check() error {
 
 	if len(p.SetParameters) > 0 && len(p.Lookup) > 0 {
 		return errBothModes
@@ -95,6 +95,28 @@ func (p *parameterStore) Init() error {
 		return fmt.Errorf("invalid on_missing value %q: must be %q or %q", p.OnMissing, onMissingError, onMissingSkip)
 	}
 
+	return nil
+
+}
+
+// ContextKeys returns the context keys set from looked up parameters
+func (p *parameterStore) ContextKeys() []string {
+
+	keys := make([]string, 0, len(p.Lookup))
+	for key := range p.Lookup {
+		keys = append(keys, key)
+	}
+
+	return keys
+
+}
+
+func (p *parameterStore) Init() error {
+
+	if err := p.Check(); err != nil {
+		return err
+	}
+
 	if p.CacheTTL == 0 && len(p.Lookup) > 0 {
 		p.CacheTTL = duration.Duration(defaultCacheTTL)
 	}
@@ -112,7 +134,7 @@ func (p *parameterStore) Init() error {
 	return nil
 }
 
-func (p *parameterStore) Run(input <-chan *record.Record, output chan<- *record.Record) error {
+func (p *parameterStore) Run(_ context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
 
 	// GetRecord treats a nil channel as an immediately closed one, so without this
 	// a source-positioned task would exit successfully having done nothing
@@ -134,10 +156,13 @@ func (p *parameterStore) Run(input <-chan *record.Record, output chan<- *record.
 		}
 
 		if err != nil {
+			if p.DeadLetter(r, err) {
+				continue
+			}
 			// a missing parameter is the one failure the pipeline author can route,
 			// so a single misconfigured tenant need not stop every other one
 			if errors.Is(err, errParameterNotFound) && p.OnMissing == onMissingSkip {
-				fmt.Printf("WARN: skipping record: %s\n", err)
+				p.RecordLogger(r).Warn(`skipping record`, `error`, err)
 				continue
 			}
 			return err
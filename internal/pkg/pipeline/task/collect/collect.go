@@ -0,0 +1,59 @@
+package collect
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+)
+
+type collect struct {
+	task.Base `yaml:",inline" json:",inline"`
+
+	records []*record.Record
+	mutex   sync.Mutex
+}
+
+func New() (task.Task, error) {
+	return &collect{}, nil
+}
+
+// Positions returns where the task can run: it needs input, and passes records on when it has output
+func (c *collect) Positions() task.Position {
+	return task.PositionMiddle | task.PositionLast
+}
+
+// Records returns the records the task read, in the order it read them
+func (c *collect) Records() []*record.Record {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return slices.Clone(c.records)
+
+}
+
+func (c *collect) Run(_ context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
+
+	if input == nil {
+		return task.ErrNilInput
+	}
+
+	for {
+		r, ok := c.GetRecord(input)
+		if !ok {
+			break
+		}
+
+		c.mutex.Lock()
+		c.records = append(c.records, r)
+		c.mutex.Unlock()
+
+		c.SendRecord(r, output)
+	}
+
+	return nil
+
+}
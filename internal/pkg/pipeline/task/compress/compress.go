@@ -2,6 +2,7 @@ package compress
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 
@@ -30,11 +31,10 @@ func New() (task.Task, error) {
 func (c *core) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	type raw core
 
-	obj := raw{
-		Format: defaultFormat,
-		Action: defaultAction,
-	}
-	if err := unmarshal(&obj); err != nil {
+	obj := (*raw)(c) // decode in place, core embeds a mutex and must not be copied
+	obj.Format = defaultFormat
+	obj.Action = defaultAction
+	if err := unmarshal(obj); err != nil {
 		return err
 	}
 
@@ -42,12 +42,15 @@ func (c *core) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		return fmt.Errorf(task.ErrUnsupportedFieldValue, `format`, obj.Format)
 	}
 
-	*c = core(obj)
-
 	return nil
 }
 
-func (c *core) Run(input <-chan *record.Record, output chan<- *record.Record) (err error) {
+// Positions returns where the task can run: it needs input
+func (c *core) Positions() task.Position {
+	return task.PositionMiddle | task.PositionLast
+}
+
+func (c *core) Run(_ context.Context, input <-chan *record.Record, output chan<- *record.Record) (err error) {
 
 	if input == nil {
 		return task.ErrNilInput
@@ -67,13 +70,15 @@ func (c *core) Run(input <-chan *record.Record, output chan<- *record.Record) (e
 		var transformedData []byte
 		var err error
 		if c.Action == defaultAction {
-			if transformedData, err = c.compress(r); err != nil {
-				return err
-			}
+			transformedData, err = c.compress(r)
 		} else {
-			if transformedData, err = c.decompress(r); err != nil {
-				return err
+			transformedData, err = c.decompress(r)
+		}
+		if err != nil {
+			if c.DeadLetter(r, err) {
+				continue
 			}
+			return err
 		}
 
 		// skip empty transformed data
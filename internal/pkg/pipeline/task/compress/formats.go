@@ -2,6 +2,7 @@ package compress
 
 import (
 	"compress/gzip"
+	"fmt"
 	"io"
 
 	"github.com/golang/snappy"
@@ -30,3 +31,16 @@ var (
 			}},
 	}
 )
+
+// NewReader decompresses r as it is read, so callers can stream a compressed
+// source instead of loading it whole
+func NewReader(format string, r io.Reader) (io.ReadCloser, error) {
+
+	handler, found := formatHandlers[format]
+	if !found {
+		return nil, fmt.Errorf("unsupported compression format: %s", format)
+	}
+
+	return handler.NewReader(r)
+
+}
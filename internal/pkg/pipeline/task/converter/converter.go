@@ -1,6 +1,7 @@
 package converter
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
@@ -10,15 +11,27 @@ import (
 type converterOutput struct {
 	Data     []byte
 	Metadata map[string]string
+	Port     string
 }
 
 type converter interface {
 	convert(data []byte, delimiter string) ([]converterOutput, error)
 }
 
+// portedConverter is implemented by formats that send their outputs on named ports
+type portedConverter interface {
+	ports() []string
+}
+
+// contextConverter is implemented by formats that set metadata in the context
+type contextConverter interface {
+	contextKeys() []string
+}
+
 type core struct {
 	task.Base `yaml:",inline" json:",inline"`
 	convert   func([]byte, string) ([]converterOutput, error) `yaml:"-" json:"-"`
+	format    converter                                       `yaml:"-" json:"-"`
 	Delimiter string                                          `yaml:"delimiter,omitempty" json:"delimiter,omitempty" default:"\t"`
 }
 
@@ -61,15 +74,41 @@ func (c *core) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		return err
 	}
 
+	if err := unmarshal(&c.Base); err != nil {
+		return err
+	}
+
 	c.convert = obj.convert
+	c.format = obj
 	c.Delimiter = m.Delimiter
-	c.Base.Name = m.Name
 
 	return nil
 
 }
 
-func (c *core) Run(input <-chan *record.Record, output chan<- *record.Record) error {
+// Ports returns the output ports of the format, if it has any
+func (c *core) Ports() []string {
+
+	if ported, ok := c.format.(portedConverter); ok {
+		return ported.ports()
+	}
+
+	return nil
+
+}
+
+// ContextKeys returns the context keys the format sets, if any
+func (c *core) ContextKeys() []string {
+
+	if format, ok := c.format.(contextConverter); ok {
+		return format.contextKeys()
+	}
+
+	return nil
+
+}
+
+func (c *core) Run(_ context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
 
 	for {
 		r, ok := c.GetRecord(input)
@@ -79,6 +118,9 @@ func (c *core) Run(input <-chan *record.Record, output chan<- *record.Record) er
 
 		outputs, err := c.convert(r.Data, c.Delimiter)
 		if err != nil {
+			if c.DeadLetter(r, err) {
+				continue
+			}
 			return err
 		}
 
@@ -88,6 +130,9 @@ func (c *core) Run(input <-chan *record.Record, output chan<- *record.Record) er
 				for k, v := range out.Metadata {
 					r.SetContextValue(k, v)
 				}
+				if out.Port != `` {
+					r.SetContextValue(string(task.CtxKeyPort), out.Port)
+				}
 
 				c.SendData(r.Context, out.Data, output)
 			}
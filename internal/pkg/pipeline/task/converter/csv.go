@@ -5,7 +5,7 @@ import (
 	ec "encoding/csv"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"strconv"
 	"strings"
 
@@ -104,7 +104,7 @@ func (c *csv) initializeColumns(data []byte) error {
 		}
 		// Keep SkipFirst as true so the convert function knows to skip this row
 	} else {
-		log.Println("No columns defined and SkipFirst is false; auto-generating column names as col1, col2, ...")
+		slog.Info(`no columns defined and skip_first is false, auto-generating column names as col1, col2, ...`)
 
 		for i := range firstRow {
 			c.Columns[i] = &csvColumn{Name: fmt.Sprintf("col%d", i+1)}
@@ -11,8 +11,29 @@ import (
 	"github.com/patterninc/caterpillar/internal/pkg/textutil"
 )
 
+// eml output ports
+const (
+	emlPortBody        = `body`
+	emlPortHeaders     = `headers`
+	emlPortAttachments = `attachments`
+)
+
+// eml context keys
+const (
+	emlFileName    = `converter_filename`
+	emlContentType = `content_type`
+)
+
 type eml struct{}
 
+func (c *eml) ports() []string {
+	return []string{emlPortBody, emlPortHeaders, emlPortAttachments}
+}
+
+func (c *eml) contextKeys() []string {
+	return []string{emlFileName, emlContentType}
+}
+
 func (c *eml) convert(data []byte, _ string) ([]converterOutput, error) {
 
 	envelope, err := enmime.ReadEnvelope(bytes.NewReader(data))
@@ -23,12 +44,12 @@ func (c *eml) convert(data []byte, _ string) ([]converterOutput, error) {
 	var outputs []converterOutput
 
 	if envelope.HTML != "" {
-		if out := c.processOutput([]byte(envelope.HTML), "body.html", "text/html"); out != nil {
+		if out := c.processOutput([]byte(envelope.HTML), "body.html", "text/html", emlPortBody); out != nil {
 			outputs = append(outputs, *out)
 		}
 	}
 	if envelope.Text != "" {
-		if out := c.processOutput([]byte(envelope.Text), "body.txt", "text/plain"); out != nil {
+		if out := c.processOutput([]byte(envelope.Text), "body.txt", "text/plain", emlPortBody); out != nil {
 			outputs = append(outputs, *out)
 		}
 	}
@@ -44,20 +65,20 @@ func (c *eml) convert(data []byte, _ string) ([]converterOutput, error) {
 		enc.SetEscapeHTML(false)
 		enc.SetIndent("", "  ")
 		if err := enc.Encode(headerMap); err == nil {
-			if out := c.processOutput(buf.Bytes(), "headers.json", "application/json"); out != nil {
+			if out := c.processOutput(buf.Bytes(), "headers.json", "application/json", emlPortHeaders); out != nil {
 				outputs = append(outputs, *out)
 			}
 		}
 	}
 
 	for _, attachment := range envelope.Attachments {
-		if out := c.processOutput(attachment.Content, attachment.FileName, attachment.ContentType); out != nil {
+		if out := c.processOutput(attachment.Content, attachment.FileName, attachment.ContentType, emlPortAttachments); out != nil {
 			outputs = append(outputs, *out)
 		}
 	}
 
 	for _, inline := range envelope.Inlines {
-		if out := c.processOutput(inline.Content, inline.FileName, inline.ContentType); out != nil {
+		if out := c.processOutput(inline.Content, inline.FileName, inline.ContentType, emlPortAttachments); out != nil {
 			outputs = append(outputs, *out)
 		}
 	}
@@ -65,7 +86,7 @@ func (c *eml) convert(data []byte, _ string) ([]converterOutput, error) {
 	return outputs, nil
 }
 
-func (c *eml) processOutput(content []byte, fileName string, contentType string) *converterOutput {
+func (c *eml) processOutput(content []byte, fileName string, contentType string, port string) *converterOutput {
 	if len(content) == 0 {
 		return nil
 	}
@@ -86,8 +107,9 @@ func (c *eml) processOutput(content []byte, fileName string, contentType string)
 	return &converterOutput{
 		Data: content,
 		Metadata: map[string]string{
-			"converter_filename": fileName,
-			"content_type":       contentType,
+			emlFileName:    fileName,
+			emlContentType: contentType,
 		},
+		Port: port,
 	}
 }
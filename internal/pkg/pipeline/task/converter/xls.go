@@ -21,6 +21,22 @@ type xls struct {
 	SanitizeSheetNames bool           `yaml:"sanitize_sheet_names,omitempty" json:"sanitize_sheet_names,omitempty"`
 }
 
+func (x *xls) contextKeys() []string {
+	return []string{sheetName}
+}
+
+// ports are the configured sheets, slugified; without sheets there are none to wire
+func (x *xls) ports() []string {
+
+	ports := make([]string, 0, len(x.Sheets))
+	for _, sheet := range x.Sheets {
+		ports = append(ports, textutil.Slugify(sheet))
+	}
+
+	return ports
+
+}
+
 func (x *xls) convert(data []byte, _ string) (outputs []converterOutput, err error) {
 	// recover to avoid crash due to panic.
 	defer func() {
@@ -112,6 +128,7 @@ func (x *xls) readSheet(reader *xlrd.Book, sheet string) (converterOutput, error
 		Metadata: map[string]string{
 			sheetName: outputSheetName,
 		},
+		Port: textutil.Slugify(sheet),
 	}, nil
 }
 
@@ -21,6 +21,22 @@ type xlsx struct {
 	SanitizeSheetNames bool           `yaml:"sanitize_sheet_names,omitempty" json:"sanitize_sheet_names,omitempty"`
 }
 
+func (x *xlsx) contextKeys() []string {
+	return []string{sheetName}
+}
+
+// ports are the configured sheets, slugified; without sheets there are none to wire
+func (x *xlsx) ports() []string {
+
+	ports := make([]string, 0, len(x.Sheets))
+	for _, sheet := range x.Sheets {
+		ports = append(ports, textutil.Slugify(sheet))
+	}
+
+	return ports
+
+}
+
 func (x *xlsx) convert(data []byte, _ string) ([]converterOutput, error) {
 	reader, err := excelize.OpenReader(bytes.NewReader(data))
 	if err != nil {
@@ -105,6 +121,7 @@ func (x *xlsx) readSheet(reader *excelize.File, sheet string) (converterOutput,
 		Metadata: map[string]string{
 			sheetName: outputSheetName,
 		},
+		Port: textutil.Slugify(sheet),
 	}, nil
 }
 
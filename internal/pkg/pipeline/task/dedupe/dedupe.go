@@ -0,0 +1,171 @@
+package dedupe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/patterninc/caterpillar/internal/pkg/duration"
+	"github.com/patterninc/caterpillar/internal/pkg/jq"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+)
+
+const (
+	defaultMaxKeys = 100000
+	storeMemory    = `memory`
+	storePebble    = `pebble`
+)
+
+var (
+	ErrIncorrectInputOutput = fmt.Errorf(`input and output channels must be provided`)
+)
+
+type dedupe struct {
+	task.Base `yaml:",inline" json:",inline"`
+	Key       *jq.Query         `yaml:"key,omitempty" json:"key,omitempty" validate:"required"`
+	TTL       duration.Duration `yaml:"ttl,omitempty" json:"ttl,omitempty"`
+	MaxKeys   int               `yaml:"max_keys,omitempty" json:"max_keys,omitempty" validate:"omitempty,gt=0"`
+	Store     string            `yaml:"store,omitempty" json:"store,omitempty" validate:"omitempty,oneof=memory pebble"`
+	Path      string            `yaml:"path,omitempty" json:"path,omitempty"`
+
+	// workers share a single store, opened by the first and closed by the last
+	store   store
+	workers int
+	mutex   sync.Mutex
+}
+
+func New() (task.Task, error) {
+	return &dedupe{
+		MaxKeys: defaultMaxKeys,
+		Store:   storeMemory,
+	}, nil
+}
+
+func (d *dedupe) Init() error {
+
+	if d.Store == storePebble && d.Path == `` {
+		return fmt.Errorf("path is required for the pebble store")
+	}
+	if d.TTL < 0 {
+		return fmt.Errorf("ttl must not be negative")
+	}
+
+	return nil
+
+}
+
+// Positions returns where the task can run: it needs both input and output
+func (d *dedupe) Positions() task.Position {
+	return task.PositionMiddle
+}
+
+func (d *dedupe) Run(_ context.Context, input <-chan *record.Record, output chan<- *record.Record) (err error) {
+
+	if input == nil || output == nil {
+		return ErrIncorrectInputOutput
+	}
+
+	store, err := d.open()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := d.close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	for {
+		r, ok := d.GetRecord(input)
+		if !ok {
+			break
+		}
+
+		duplicate, err := d.isDuplicate(store, r)
+		if err != nil {
+			if d.DeadLetter(r, err) {
+				continue
+			}
+			return err
+		}
+		if duplicate {
+			d.RecordLogger(r).Debug(`dropping duplicate record`)
+			continue
+		}
+
+		d.SendRecord(r, output)
+	}
+
+	return nil
+
+}
+
+// isDuplicate records the key of r and reports whether it was seen before; a
+// record whose key is null is never a duplicate
+func (d *dedupe) isDuplicate(store store, r *record.Record) (bool, error) {
+
+	value, err := d.Key.Execute(r.Data)
+	if err != nil {
+		return false, err
+	}
+	if value == nil {
+		return false, nil
+	}
+
+	key, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	var expires time.Time
+	if d.TTL > 0 {
+		expires = now.Add(time.Duration(d.TTL))
+	}
+
+	return store.seen(string(key), now, expires)
+
+}
+
+func (d *dedupe) open() (store, error) {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.store == nil {
+		switch d.Store {
+		case storePebble:
+			s, err := newPebbleStore(d.Path, d.Logger())
+			if err != nil {
+				return nil, fmt.Errorf("cannot open dedupe store %s: %w", d.Path, err)
+			}
+			d.store = s
+		default:
+			d.store = newMemoryStore(d.MaxKeys)
+		}
+	}
+	d.workers++
+
+	return d.store, nil
+
+}
+
+func (d *dedupe) close() error {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.workers--
+	if d.workers > 0 {
+		return nil
+	}
+
+	err := d.store.close()
+	d.store = nil
+
+	return err
+
+}
@@ -0,0 +1,143 @@
+package dedupe
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// store remembers the keys already seen. seen records key and reports whether it
+// was recorded before and has not expired since; expires is zero for keys that
+// never expire.
+type store interface {
+	seen(key string, now, expires time.Time) (bool, error)
+	close() error
+}
+
+// memoryStore is a bounded LRU: once full, the least recently seen key is
+// forgotten to make room
+type memoryStore struct {
+	maxKeys int
+	keys    map[string]*list.Element
+	lru     *list.List
+	sync.Mutex
+}
+
+type entry struct {
+	key     string
+	expires time.Time
+}
+
+func newMemoryStore(maxKeys int) *memoryStore {
+	return &memoryStore{
+		maxKeys: maxKeys,
+		keys:    make(map[string]*list.Element, maxKeys),
+		lru:     list.New(),
+	}
+}
+
+func (m *memoryStore) seen(key string, now, expires time.Time) (bool, error) {
+
+	m.Lock()
+	defer m.Unlock()
+
+	if element, found := m.keys[key]; found {
+		e := element.Value.(*entry)
+		m.lru.MoveToFront(element)
+		if e.expires.IsZero() || now.Before(e.expires) {
+			return true, nil
+		}
+		e.expires = expires
+		return false, nil
+	}
+
+	m.keys[key] = m.lru.PushFront(&entry{key: key, expires: expires})
+	if m.lru.Len() > m.maxKeys {
+		oldest := m.lru.Back()
+		m.lru.Remove(oldest)
+		delete(m.keys, oldest.Value.(*entry).key)
+	}
+
+	return false, nil
+
+}
+
+func (m *memoryStore) close() error {
+	return nil
+}
+
+// pebbleStore keeps the keys in a local pebble database, so they survive a
+// restart; the value of each key is its expiry in unix nanoseconds, 0 for never
+type pebbleStore struct {
+	db *pebble.DB
+	sync.Mutex
+}
+
+func newPebbleStore(path string, logger *slog.Logger) (*pebbleStore, error) {
+
+	db, err := pebble.Open(path, &pebble.Options{Logger: pebbleLogger{logger}})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pebbleStore{db: db}, nil
+
+}
+
+func (p *pebbleStore) seen(key string, now, expires time.Time) (bool, error) {
+
+	// the lookup and the write must not interleave with another worker's
+	p.Lock()
+	defer p.Unlock()
+
+	value, closer, err := p.db.Get([]byte(key))
+	switch {
+	case err == nil:
+		valid := len(value) == 8
+		stored := int64(0)
+		if valid {
+			stored = int64(binary.BigEndian.Uint64(value))
+		}
+		closer.Close()
+		if valid && (stored == 0 || now.UnixNano() < stored) {
+			return true, nil
+		}
+	case !errors.Is(err, pebble.ErrNotFound):
+		return false, err
+	}
+
+	var expiry int64
+	if !expires.IsZero() {
+		expiry = expires.UnixNano()
+	}
+	value = binary.BigEndian.AppendUint64(nil, uint64(expiry))
+
+	// the write-ahead log is still written, so keys survive the process exiting
+	return false, p.db.Set([]byte(key), value, pebble.NoSync)
+
+}
+
+func (p *pebbleStore) close() error {
+	return p.db.Close()
+}
+
+// pebbleLogger sends pebble's housekeeping messages to the task's logger at debug level
+type pebbleLogger struct {
+	logger *slog.Logger
+}
+
+func (l pebbleLogger) Infof(format string, args ...any) {
+	l.logger.Debug(fmt.Sprintf(format, args...))
+}
+
+func (l pebbleLogger) Fatalf(format string, args ...any) {
+	l.logger.Error(fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
@@ -0,0 +1,344 @@
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/patterninc/caterpillar/internal/pkg/config"
+	"github.com/patterninc/caterpillar/internal/pkg/duration"
+	"github.com/patterninc/caterpillar/internal/pkg/jq"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+)
+
+const (
+	defaultRegion = `us-west-2`
+	joinInner     = `inner`
+	joinLeft      = `left`
+)
+
+var (
+	ErrIncorrectInputOutput = fmt.Errorf(`input and output channels must be provided`)
+)
+
+type enrich struct {
+	task.Base `yaml:",inline" json:",inline"`
+	Key       *jq.Query         `yaml:"key,omitempty" json:"key,omitempty" validate:"required"`
+	TableKey  *jq.Query         `yaml:"table_key,omitempty" json:"table_key,omitempty" validate:"required"`
+	Path      config.String     `yaml:"path,omitempty" json:"path,omitempty"`
+	Format    string            `yaml:"format,omitempty" json:"format,omitempty" validate:"omitempty,oneof=csv jsonl"`
+	Region    string            `yaml:"region,omitempty" json:"region,omitempty"`
+	SideInput string            `yaml:"side_input,omitempty" json:"side_input,omitempty"`
+	Wait      duration.Duration `yaml:"wait,omitempty" json:"wait,omitempty"`
+	Join      string            `yaml:"join,omitempty" json:"join,omitempty" validate:"omitempty,oneof=inner left"`
+	Fields    []string          `yaml:"fields,omitempty" json:"fields,omitempty"`
+	Into      string            `yaml:"into,omitempty" json:"into,omitempty"`
+	Overwrite bool              `yaml:"overwrite,omitempty" json:"overwrite,omitempty"`
+
+	// the table and the records waiting for a side input match are shared by all workers
+	load    sync.Once
+	loadErr error
+	table   map[string]map[string]any
+	waiting map[string][]*held
+	queue   []*held // waiting records in the order they expire
+	mutex   sync.Mutex
+}
+
+// held is a record waiting for its key to arrive on the side input
+type held struct {
+	record   *record.Record
+	deadline time.Time
+	released bool
+}
+
+func New() (task.Task, error) {
+	return &enrich{
+		Region:  defaultRegion,
+		Join:    joinLeft,
+		table:   make(map[string]map[string]any),
+		waiting: make(map[string][]*held),
+	}, nil
+}
+
+func (e *enrich) Init() error {
+
+	if e.Path == `` && e.SideInput == `` {
+		return fmt.Errorf("either path or side_input is required")
+	}
+	if e.Wait < 0 {
+		return fmt.Errorf("wait must not be negative")
+	}
+	if e.Wait > 0 && e.SideInput == `` {
+		return fmt.Errorf("wait requires a side_input")
+	}
+
+	return nil
+
+}
+
+// Positions returns where the task can run: it needs both input and output
+func (e *enrich) Positions() task.Position {
+	return task.PositionMiddle
+}
+
+// SideInputs returns the task whose records build the table, if any
+func (e *enrich) SideInputs() []string {
+	if e.SideInput == `` {
+		return nil
+	}
+	return []string{e.SideInput}
+}
+
+func (e *enrich) Run(ctx context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
+
+	if input == nil || output == nil {
+		return ErrIncorrectInputOutput
+	}
+
+	// the first worker loads the table, the others wait for it
+	e.load.Do(func() {
+		if e.Path != `` {
+			e.loadErr = e.loadTable(ctx)
+		}
+	})
+	if e.loadErr != nil {
+		return e.loadErr
+	}
+
+	// read input on its own goroutine, so waiting records expire on time even
+	// when no records arrive
+	records, done := make(chan *record.Record), make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(records)
+		for {
+			r, ok := e.GetRecord(input)
+			if !ok {
+				return
+			}
+			select {
+			case records <- r:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var tick <-chan time.Time
+	if e.Wait > 0 {
+		ticker := time.NewTicker(time.Duration(e.Wait))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case r, ok := <-records:
+			if !ok {
+				// nothing else can match once the input is closed
+				return e.emitAll(e.release(time.Time{}), nil, output)
+			}
+			if err := e.process(r, output); err != nil {
+				if e.DeadLetter(r, err) {
+					continue
+				}
+				return err
+			}
+		case now := <-tick:
+			if err := e.emitAll(e.release(now), nil, output); err != nil {
+				return err
+			}
+		}
+	}
+
+}
+
+func (e *enrich) process(r *record.Record, output chan<- *record.Record) error {
+
+	// side input records, marked by the pipeline, update the table and release the
+	// records waiting for them
+	if sideInput, found := r.GetContextValue(string(task.CtxKeySideInput)); found && e.SideInput != `` && sideInput == e.SideInput {
+		row, matched, err := e.addRow(r.Data)
+		if err != nil {
+			return err
+		}
+		return e.emitAll(matched, row, output)
+	}
+
+	value, err := e.Key.Execute(r.Data)
+	if err != nil {
+		return fmt.Errorf("key: %w", err)
+	}
+	if value == nil {
+		return e.emit(r, nil, output)
+	}
+
+	key, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	e.mutex.Lock()
+	row, found := e.table[string(key)]
+	if !found && e.Wait > 0 {
+		h := &held{record: r, deadline: time.Now().Add(time.Duration(e.Wait))}
+		e.waiting[string(key)] = append(e.waiting[string(key)], h)
+		e.queue = append(e.queue, h)
+		e.mutex.Unlock()
+		return nil
+	}
+	e.mutex.Unlock()
+
+	return e.emit(r, row, output)
+
+}
+
+// addRow adds a table row, replacing any row with the same key, and returns it
+// with the records that were waiting for it
+func (e *enrich) addRow(data []byte) (map[string]any, []*record.Record, error) {
+
+	row := make(map[string]any)
+	if err := json.Unmarshal(data, &row); err != nil {
+		return nil, nil, fmt.Errorf("table row is not a JSON object: %w", err)
+	}
+
+	value, err := e.TableKey.Execute(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("table_key: %w", err)
+	}
+	if value == nil {
+		return nil, nil, nil
+	}
+
+	key, err := json.Marshal(value)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.table[string(key)] = row
+
+	var matched []*record.Record
+	for _, h := range e.waiting[string(key)] {
+		h.released = true
+		matched = append(matched, h.record)
+	}
+	delete(e.waiting, string(key))
+
+	return row, matched, nil
+
+}
+
+// release returns the waiting records whose deadline passed by now, or all of
+// them when now is zero
+func (e *enrich) release(now time.Time) []*record.Record {
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	var expired []*record.Record
+	for len(e.queue) > 0 && (now.IsZero() || !now.Before(e.queue[0].deadline)) {
+		h := e.queue[0]
+		e.queue = e.queue[1:]
+		if h.released {
+			continue
+		}
+		expired = append(expired, h.record)
+	}
+
+	if now.IsZero() {
+		e.waiting = make(map[string][]*held)
+		return expired
+	}
+	for key, list := range e.waiting {
+		kept := list[:0]
+		for _, h := range list {
+			if !h.released && now.Before(h.deadline) {
+				kept = append(kept, h)
+			}
+		}
+		if len(kept) == 0 {
+			delete(e.waiting, key)
+		} else {
+			e.waiting[key] = kept
+		}
+	}
+
+	return expired
+
+}
+
+func (e *enrich) emitAll(records []*record.Record, row map[string]any, output chan<- *record.Record) error {
+
+	for _, r := range records {
+		if err := e.emit(r, row, output); err != nil {
+			if e.DeadLetter(r, err) {
+				continue
+			}
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+// emit sends r merged with row; a nil row means no match
+func (e *enrich) emit(r *record.Record, row map[string]any, output chan<- *record.Record) error {
+
+	if row == nil {
+		if e.Join == joinLeft {
+			e.SendData(r.Context, r.Data, output)
+		} else {
+			e.RecordLogger(r).Debug(`dropping record without a match`)
+		}
+		return nil
+	}
+
+	data, err := e.merge(r.Data, row)
+	if err != nil {
+		return err
+	}
+
+	e.SendData(r.Context, data, output)
+
+	return nil
+
+}
+
+func (e *enrich) merge(data []byte, row map[string]any) ([]byte, error) {
+
+	document := make(map[string]any)
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("record is not a JSON object: %w", err)
+	}
+
+	fields := row
+	if len(e.Fields) > 0 {
+		fields = make(map[string]any, len(e.Fields))
+		for _, name := range e.Fields {
+			if value, found := row[name]; found {
+				fields[name] = value
+			}
+		}
+	}
+
+	if e.Into != `` {
+		document[e.Into] = fields
+	} else {
+		for name, value := range fields {
+			if _, exists := document[name]; exists && !e.Overwrite {
+				continue
+			}
+			document[name] = value
+		}
+	}
+
+	return json.Marshal(document)
+
+}
@@ -0,0 +1,165 @@
+package enrich
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	s3client "github.com/patterninc/caterpillar/internal/pkg/pipeline/task/file/s3_client"
+)
+
+const (
+	formatCSV   = `csv`
+	formatJSONL = `jsonl`
+	s3Prefix    = `s3://`
+	filePrefix  = `file://`
+	maxLineSize = 64 * 1024 * 1024
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// loadTable reads every row of the lookup file into the table
+func (e *enrich) loadTable(ctx context.Context) error {
+
+	path, err := e.Path.Get(nil)
+	if err != nil {
+		return err
+	}
+
+	content, err := e.open(ctx, path)
+	if err != nil {
+		return fmt.Errorf("cannot open lookup file %s: %w", path, err)
+	}
+	defer content.Close()
+
+	format := e.Format
+	if format == `` {
+		format = formatJSONL
+		if strings.HasSuffix(strings.ToLower(path), `.csv`) {
+			format = formatCSV
+		}
+	}
+
+	rows := 0
+	add := func(row []byte) error {
+		rows++
+		if _, _, err := e.addRow(row); err != nil {
+			return fmt.Errorf("lookup file %s, row %d: %w", path, rows, err)
+		}
+		return nil
+	}
+
+	if format == formatCSV {
+		err = readCSV(content, add)
+	} else {
+		err = readJSONL(content, add)
+	}
+	if err != nil {
+		return err
+	}
+
+	e.Logger().Info(`loaded lookup table`, `path`, path, `rows`, rows, `keys`, len(e.table))
+
+	return nil
+
+}
+
+func (e *enrich) open(ctx context.Context, path string) (io.ReadCloser, error) {
+
+	if !strings.HasPrefix(path, s3Prefix) {
+		return os.Open(strings.TrimPrefix(path, filePrefix))
+	}
+
+	client, err := s3client.New(ctx, e.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket, key, err := s3client.ParseURI(path)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Body, nil
+
+}
+
+// readCSV turns every line after the header into a JSON object keyed by column name
+func readCSV(content io.Reader, add func([]byte) error) error {
+
+	buffered := bufio.NewReader(content)
+	if bom, _ := buffered.Peek(len(utf8BOM)); bytes.Equal(bom, utf8BOM) {
+		buffered.Discard(len(utf8BOM))
+	}
+
+	reader := csv.NewReader(buffered)
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for {
+		fields, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		row := make(map[string]any, len(header))
+		for i, name := range header {
+			if i < len(fields) {
+				row[name] = fields[i]
+			}
+		}
+
+		data, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		if err := add(data); err != nil {
+			return err
+		}
+	}
+
+}
+
+func readJSONL(content io.Reader, add func([]byte) error) error {
+
+	scanner := bufio.NewScanner(content)
+	scanner.Buffer(nil, maxLineSize)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := add(line); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+
+}
@@ -0,0 +1,325 @@
+package exec
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patterninc/caterpillar/internal/pkg/config"
+	"github.com/patterninc/caterpillar/internal/pkg/duration"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/http/status"
+)
+
+const (
+	modePerRecord            = `per_record`
+	modeStream               = `stream`
+	defaultExpectedExitCodes = `0`
+	defaultDelimiter         = "\n"
+	maxStreamRecordSize      = 64 * 1024 * 1024
+	waitDelay                = time.Second // for children of a stopped command to release its output
+	stderrContextKey         = `exec-stderr`
+	exitCodeContextKey       = `exec-exit-code`
+)
+
+type execCore struct {
+	task.Base         `yaml:",inline" json:",inline"`
+	Command           string            `yaml:"command" json:"command" validate:"required"`
+	Args              []config.String   `yaml:"args,omitempty" json:"args,omitempty"`
+	Env               map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	Mode              string            `yaml:"mode,omitempty" json:"mode,omitempty" validate:"oneof=per_record stream"`
+	Delimiter         string            `yaml:"delimiter,omitempty" json:"delimiter,omitempty"`
+	Timeout           duration.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	ExpectedExitCodes *status.Statuses  `yaml:"expected_exit_codes,omitempty" json:"expected_exit_codes,omitempty"`
+}
+
+func New() (task.Task, error) {
+
+	expectedExitCodes, err := status.New(defaultExpectedExitCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &execCore{
+		Mode:              modePerRecord,
+		Delimiter:         defaultDelimiter,
+		ExpectedExitCodes: expectedExitCodes,
+	}, nil
+
+}
+
+func (e *execCore) Init() error {
+
+	if _, err := exec.LookPath(e.Command); err != nil {
+		return err
+	}
+
+	if e.Mode == modeStream {
+		if e.Delimiter == `` {
+			return fmt.Errorf("delimiter must not be empty")
+		}
+		if e.Timeout != 0 {
+			return fmt.Errorf("timeout only applies with mode: %s", modePerRecord)
+		}
+	}
+
+	return nil
+
+}
+
+// ContextKeys returns the context keys set on the records sent by a command per record
+func (e *execCore) ContextKeys() []string {
+
+	if e.Mode == modeStream {
+		return nil
+	}
+
+	return []string{stderrContextKey, exitCodeContextKey}
+
+}
+
+func (e *execCore) Run(ctx context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
+
+	if e.Mode == modeStream {
+		return e.stream(ctx, input, output)
+	}
+
+	// without input, the command runs once as a source
+	if input == nil {
+		r, err := e.runCommand(ctx, &record.Record{})
+		if err != nil {
+			if e.DeadLetter(nil, err) {
+				return nil
+			}
+			return err
+		}
+		e.SendData(r.Context, r.Data, output)
+		return nil
+	}
+
+	for {
+		r, ok := e.GetRecord(input)
+		if !ok {
+			break
+		}
+
+		result, err := e.runCommand(context.Background(), r)
+		if err != nil {
+			if e.DeadLetter(r, err) {
+				continue
+			}
+			return err
+		}
+		e.SendData(result.Context, result.Data, output)
+	}
+
+	return nil
+
+}
+
+// runCommand runs the command with the data of r on stdin, and returns its stdout
+// as a record with the context of r, its stderr and its exit code
+func (e *execCore) runCommand(ctx context.Context, r *record.Record) (*record.Record, error) {
+
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(e.Timeout))
+		defer cancel()
+	}
+
+	cmd, err := e.command(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(r.Data)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	exitCode := 0
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			return nil, fmt.Errorf("command %s timed out after %s", e.Command, time.Duration(e.Timeout))
+		case errors.As(err, &exitErr):
+			exitCode = exitErr.ExitCode()
+		default:
+			return nil, err
+		}
+	}
+
+	if !e.ExpectedExitCodes.Has(exitCode) {
+		return nil, fmt.Errorf("command %s exited with code %d: %s", e.Command, exitCode, strings.TrimSpace(stderr.String()))
+	}
+
+	result := &record.Record{Data: stdout.Bytes(), Context: r.Context}
+	result.SetContextValue(stderrContextKey, strings.TrimSpace(stderr.String()))
+	result.SetContextValue(exitCodeContextKey, strconv.Itoa(exitCode))
+
+	return result, nil
+
+}
+
+// stream runs the command once for the worker, writes the records read to its
+// stdin, each followed by the delimiter, and sends its stdout split on it
+func (e *execCore) stream(ctx context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
+
+	// a task with input drains it whatever ctx says, so only a source is interrupted
+	commandContext := context.Background()
+	if input == nil {
+		commandContext = ctx
+	}
+	cmd, err := e.command(commandContext, nil)
+	if err != nil {
+		return err
+	}
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+
+	var stdin io.WriteCloser
+	if input != nil {
+		if stdin, err = cmd.StdinPipe(); err != nil {
+			return err
+		}
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			e.Logger().Warn(`command stderr`, `command`, e.Command, `line`, scanner.Text())
+		}
+		// a line too long for the scanner stops it, so drain the rest or the command
+		// blocks writing to stderr
+		if err := scanner.Err(); err != nil {
+			e.Logger().Warn(`cannot log command stderr`, `command`, e.Command, `error`, err)
+		}
+		io.Copy(io.Discard, stderr)
+	}()
+
+	// records are written while the output is read, so neither pipe fills up
+	written := make(chan error, 1)
+	if input != nil {
+		go func() {
+			written <- e.write(input, stdin)
+		}()
+	} else {
+		written <- nil
+	}
+
+	delimiter := []byte(e.Delimiter)
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamRecordSize)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.Index(data, delimiter); i >= 0 {
+			return i + len(delimiter), data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+	for scanner.Scan() {
+		e.SendData(nil, bytes.Clone(scanner.Bytes()), output)
+	}
+	readErr := scanner.Err()
+	if readErr != nil {
+		cmd.Process.Kill()
+	}
+
+	writeErr := <-written
+	wg.Wait()
+	waitErr := cmd.Wait()
+
+	switch {
+	case readErr != nil:
+		return fmt.Errorf("command %s: %w", e.Command, readErr)
+	case writeErr != nil:
+		return fmt.Errorf("command %s stopped reading records: %w", e.Command, writeErr)
+	}
+
+	var exitErr *exec.ExitError
+	if waitErr != nil && !(input == nil && ctx.Err() != nil) {
+		if !errors.As(waitErr, &exitErr) || !e.ExpectedExitCodes.Has(exitErr.ExitCode()) {
+			return fmt.Errorf("command %s: %w", e.Command, waitErr)
+		}
+	}
+
+	return nil
+
+}
+
+// write writes the records read to stdin and closes it; the input is drained
+// even when the command stops reading
+func (e *execCore) write(input <-chan *record.Record, stdin io.WriteCloser) error {
+
+	var err error
+	for {
+		r, ok := e.GetRecord(input)
+		if !ok {
+			break
+		}
+		if err != nil {
+			continue
+		}
+		if _, err = stdin.Write(r.Data); err == nil {
+			_, err = io.WriteString(stdin, e.Delimiter)
+		}
+	}
+
+	if closeErr := stdin.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+
+}
+
+// command returns the command with its arguments evaluated against r, which is
+// nil when the command does not run for a record
+func (e *execCore) command(ctx context.Context, r *record.Record) (*exec.Cmd, error) {
+
+	args := make([]string, 0, len(e.Args))
+	for _, arg := range e.Args {
+		value, err := arg.Get(r)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+
+	cmd := exec.CommandContext(ctx, e.Command, args...)
+	cmd.WaitDelay = waitDelay
+	if len(e.Env) > 0 {
+		cmd.Env = os.Environ()
+		for key, value := range e.Env {
+			cmd.Env = append(cmd.Env, key+`=`+value)
+		}
+	}
+
+	return cmd, nil
+
+}
@@ -0,0 +1,261 @@
+package exec_plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+)
+
+const (
+	envTaskName   = `CATERPILLAR_TASK_NAME`
+	envTaskConfig = `CATERPILLAR_TASK_CONFIG`
+)
+
+// Plugin is a task type implemented by an executable, declared in the plugins
+// section of a pipeline. Each worker of a task of this type runs the command
+// and exchanges records with it as lines of JSON over stdin and stdout.
+type Plugin struct {
+	Type        string            `yaml:"type" json:"type" validate:"required"`
+	Command     string            `yaml:"command" json:"command" validate:"required"`
+	Args        []string          `yaml:"args,omitempty" json:"args,omitempty"`
+	Env         map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	ContextKeys []string          `yaml:"context_keys,omitempty" json:"context_keys,omitempty"` // keys the plugin sets, for validate
+}
+
+// message is a record as the plugin reads and writes it: data is set when the
+// data is valid UTF-8, data_base64 otherwise
+type message struct {
+	Data       *string           `json:"data,omitempty"`
+	DataBase64 []byte            `json:"data_base64,omitempty"`
+	Context    map[string]string `json:"context,omitempty"`
+}
+
+// reply is the line the plugin writes for each record it reads, and for every
+// batch it sends once its input is closed
+type reply struct {
+	Records []*message `json:"records,omitempty"`
+	Error   string     `json:"error,omitempty"`
+}
+
+type execPlugin struct {
+	task.Base `yaml:",inline" json:",inline"`
+	Config    map[string]any `yaml:",inline" json:"config,omitempty"` // fields of the task passed to the plugin
+
+	plugin *Plugin
+}
+
+// New returns the constructor of the tasks of the plugin's type
+func (p *Plugin) New() (task.Task, error) {
+	return &execPlugin{plugin: p}, nil
+}
+
+func (e *execPlugin) Init() error {
+
+	if _, err := exec.LookPath(e.plugin.Command); err != nil {
+		return fmt.Errorf("plugin %s: %w", e.plugin.Type, err)
+	}
+
+	if _, err := json.Marshal(e.Config); err != nil {
+		return fmt.Errorf("plugin %s: the task configuration cannot be passed as JSON: %w", e.plugin.Type, err)
+	}
+
+	return nil
+
+}
+
+// ContextKeys returns the context keys the plugin declares it sets
+func (e *execPlugin) ContextKeys() []string {
+	return e.plugin.ContextKeys
+}
+
+func (e *execPlugin) Run(ctx context.Context, input <-chan *record.Record, output chan<- *record.Record) (err error) {
+
+	config, err := json.Marshal(e.Config)
+	if err != nil {
+		return err
+	}
+
+	// a task with input drains it whatever ctx says, so only a source is interrupted
+	cmd := exec.Command(e.plugin.Command, e.plugin.Args...)
+	if input == nil {
+		cmd = exec.CommandContext(ctx, e.plugin.Command, e.plugin.Args...)
+		cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	}
+	cmd.Env = append(os.Environ(), envTaskName+`=`+e.Name, envTaskConfig+`=`+string(config))
+	for key, value := range e.plugin.Env {
+		cmd.Env = append(cmd.Env, key+`=`+value)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("plugin %s: %w", e.plugin.Type, err)
+	}
+
+	logged := make(chan struct{})
+	go func() {
+		defer close(logged)
+		e.logStderr(stderr)
+	}()
+
+	// on failure the plugin is stopped, so it is not left waiting for input
+	defer func() {
+		if err != nil {
+			cmd.Process.Kill()
+			stdin.Close()
+			<-logged
+			cmd.Wait()
+		}
+	}()
+
+	replies := bufio.NewReader(stdout)
+	encoder := json.NewEncoder(stdin)
+
+	if input != nil {
+		for {
+			r, ok := e.GetRecord(input)
+			if !ok {
+				break
+			}
+			if err := encoder.Encode(newMessage(r.Data, r.ContextValues())); err != nil {
+				return fmt.Errorf("plugin %s stopped reading records: %w", e.plugin.Type, err)
+			}
+			rep, err := readReply(replies)
+			if err != nil {
+				return fmt.Errorf("plugin %s: %w", e.plugin.Type, err)
+			}
+			if rep == nil {
+				return fmt.Errorf("plugin %s exited without replying to record %d", e.plugin.Type, r.ID)
+			}
+			if rep.Error != `` {
+				if e.DeadLetter(r, fmt.Errorf("%s", rep.Error)) {
+					continue
+				}
+				return fmt.Errorf("plugin %s: %s", e.plugin.Type, rep.Error)
+			}
+			e.send(r.Context, rep.Records, output)
+		}
+	}
+
+	// what the plugin sends once its input is closed, e.g. aggregates, has no record to come from
+	stdin.Close()
+	for {
+		rep, err := readReply(replies)
+		if err != nil {
+			return fmt.Errorf("plugin %s: %w", e.plugin.Type, err)
+		}
+		if rep == nil {
+			break
+		}
+		if rep.Error != `` {
+			if e.DeadLetter(nil, fmt.Errorf("%s", rep.Error)) {
+				continue
+			}
+			return fmt.Errorf("plugin %s: %s", e.plugin.Type, rep.Error)
+		}
+		e.send(nil, rep.Records, output)
+	}
+
+	<-logged
+	if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("plugin %s: %w", e.plugin.Type, err)
+	}
+
+	return nil
+
+}
+
+// send sends the records of a reply with the context of the record they come
+// from, and the context the plugin set on top of it
+func (e *execPlugin) send(recordContext record.Metadata, messages []*message, output chan<- *record.Record) {
+
+	for _, m := range messages {
+		if m == nil {
+			continue
+		}
+		data := m.DataBase64
+		if m.Data != nil {
+			data = []byte(*m.Data)
+		}
+		rc := &record.Record{Context: recordContext}
+		for key, value := range m.Context {
+			rc.SetContextValue(key, value)
+		}
+		e.SendData(rc.Context, data, output)
+	}
+
+}
+
+// logStderr logs what the plugin writes to stderr, line by line
+func (e *execPlugin) logStderr(stderr io.Reader) {
+
+	scanner := bufio.NewScanner(stderr)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		e.Logger().Warn(`plugin stderr`, `plugin`, e.plugin.Type, `line`, scanner.Text())
+	}
+
+	// a line too long for the scanner stops it, so drain the rest or the plugin
+	// blocks writing to stderr
+	if err := scanner.Err(); err != nil {
+		e.Logger().Warn(`cannot log plugin stderr`, `plugin`, e.plugin.Type, `error`, err)
+	}
+	io.Copy(io.Discard, stderr)
+
+}
+
+func newMessage(data []byte, context map[string]string) *message {
+
+	m := &message{Context: context}
+	if utf8.Valid(data) {
+		text := string(data)
+		m.Data = &text
+	} else {
+		m.DataBase64 = data
+	}
+
+	return m
+
+}
+
+// readReply reads the next reply of the plugin; it returns nil once the plugin
+// closed its stdout
+func readReply(replies *bufio.Reader) (*reply, error) {
+
+	for {
+		line, err := replies.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			rep := &reply{}
+			if err := json.Unmarshal(line, rep); err != nil {
+				return nil, fmt.Errorf("invalid reply %q: %w", strings.TrimSpace(string(line)), err)
+			}
+			return rep, nil
+		}
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+}
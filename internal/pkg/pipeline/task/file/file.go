@@ -5,7 +5,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
 	"net/url"
 	"path/filepath"
 	"strings"
@@ -24,7 +23,7 @@ const (
 )
 
 type reader interface {
-	read(string) (io.ReadCloser, error)
+	read(string) (io.ReadCloser, map[string]string, error) // the metadata is nil where files have none
 	parse(string) ([]string, error)
 }
 
@@ -41,14 +40,18 @@ var (
 )
 
 type file struct {
-	task.Base       `yaml:",inline" json:",inline"`
-	Path            config.String            `yaml:"path,omitempty" json:"path,omitempty"`
-	SuccessFile     bool                     `yaml:"success_file,omitempty" json:"success_file,omitempty"`
-	SuccessFileName config.String            `yaml:"success_file_name,omitempty" json:"success_file_name,omitempty"`
-	Region          string                   `yaml:"region,omitempty" json:"region,omitempty"`
-	StorageClass    storageClass             `yaml:"storage_class,omitempty" json:"storage_class,omitempty"`
-	Tags            map[string]config.String `yaml:"tags,omitempty" json:"tags,omitempty"`
-	Delimiter       string                   `yaml:"delimiter,omitempty" json:"delimiter,omitempty"`
+	task.Base        `yaml:",inline" json:",inline"`
+	Path             config.String            `yaml:"path,omitempty" json:"path,omitempty"`
+	SuccessFile      bool                     `yaml:"success_file,omitempty" json:"success_file,omitempty"`
+	SuccessFileName  config.String            `yaml:"success_file_name,omitempty" json:"success_file_name,omitempty"`
+	Region           string                   `yaml:"region,omitempty" json:"region,omitempty"`
+	StorageClass     storageClass             `yaml:"storage_class,omitempty" json:"storage_class,omitempty"`
+	Tags             map[string]config.String `yaml:"tags,omitempty" json:"tags,omitempty"`
+	Delimiter        string                   `yaml:"delimiter,omitempty" json:"delimiter,omitempty"`
+	Stream           bool                     `yaml:"stream,omitempty" json:"stream,omitempty"`
+	MaxRecordSize    int                      `yaml:"max_record_size,omitempty" json:"max_record_size,omitempty" validate:"omitempty,gt=0"`
+	Compression      string                   `yaml:"compression,omitempty" json:"compression,omitempty" validate:"omitempty,oneof=none auto gzip snappy"`
+	PropagateContext bool                     `yaml:"propagate_context,omitempty" json:"propagate_context,omitempty"`
 }
 
 func New() (task.Task, error) {
@@ -58,11 +61,31 @@ func New() (task.Task, error) {
 		Region:          defaultRegion,
 		StorageClass:    defaultStorageClass,
 		Delimiter:       defaultDelimiter,
+		MaxRecordSize:   defaultMaxRecordSize,
+		Compression:     compressionNone,
 		SuccessFileName: defaultSuccessFileName,
 	}, nil
 }
 
-func (f *file) Run(input <-chan *record.Record, output chan<- *record.Record) error {
+// Positions returns where the task can run: a file is either read or written
+func (f *file) Positions() task.Position {
+	return task.PositionFirst | task.PositionLast
+}
+
+// ContextKeys returns the context keys set on the records read from files, and
+// with propagate_context, any key of the metadata of S3 objects
+func (f *file) ContextKeys() []string {
+
+	keys := []string{string(task.CtxKeyFileNameWrite), string(task.CtxKeyFilePathWrite)}
+	if f.PropagateContext {
+		keys = append(keys, `*`)
+	}
+
+	return keys
+
+}
+
+func (f *file) Run(ctx context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
 
 	if err := validateStorageClass(f.StorageClass); err != nil {
 		return err
@@ -75,7 +98,7 @@ func (f *file) Run(input <-chan *record.Record, output chan<- *record.Record) er
 
 	// do we send data to output?
 	if input == nil {
-		if err := f.readFile(output); err != nil {
+		if err := f.readFile(ctx, output); err != nil {
 			return err
 		}
 	} else {
@@ -95,7 +118,7 @@ func (f *file) Run(input <-chan *record.Record, output chan<- *record.Record) er
 
 }
 
-func (f *file) readFile(output chan<- *record.Record) error {
+func (f *file) readFile(ctx context.Context, output chan<- *record.Record) error {
 
 	// let's get the glob
 	glob, err := f.Path.Get(nil)
@@ -130,27 +153,32 @@ func (f *file) readFile(output chan<- *record.Record) error {
 		return err
 	}
 
+	checkpoint := f.Checkpoint()
+
 	for _, path := range paths {
 
-		readerCloser, err := reader.read(path)
-		if err != nil {
-			return err
+		// stop between files once the pipeline is shutting down
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// skip files an earlier run already read
+		if checkpoint != nil && checkpoint.Done(path) {
+			f.Logger().Debug(`skipping file completed by an earlier run`, `path`, path)
+			continue
 		}
-		defer readerCloser.Close()
 
-		content, err := io.ReadAll(readerCloser)
+		completed, err := f.readPath(ctx, reader, path, output)
 		if err != nil {
 			return err
 		}
 
-		// Create a default record with context
-		fileName := textutil.SlugifyFileName(filepath.Base(path))
-		rc := &record.Record{Context: ctx}
-		rc.SetContextValue(string(task.CtxKeyFileNameWrite), fileName)
-		rc.SetContextValue(string(task.CtxKeyFilePathWrite), textutil.SlugifyFilePath(path))
-
-		// let's write content to output channel
-		f.SendData(rc.Context, content, output)
+		// a stream interrupted by shutdown is read again from the start on resume
+		if completed && checkpoint != nil {
+			if err := checkpoint.Complete(path); err != nil {
+				return err
+			}
+		}
 
 	}
 
@@ -158,6 +186,47 @@ func (f *file) readFile(output chan<- *record.Record) error {
 
 }
 
+// readPath sends the content of a single path, either as one record or, when
+// streaming, as one record per chunk; it reports whether the whole path was read
+func (f *file) readPath(ctx context.Context, reader reader, path string, output chan<- *record.Record) (bool, error) {
+
+	readerCloser, metadata, err := reader.read(path)
+	if err != nil {
+		return false, err
+	}
+	defer readerCloser.Close()
+
+	content, err := f.decompress(path, readerCloser)
+	if err != nil {
+		return false, err
+	}
+	defer content.Close()
+
+	// Create a default record with context
+	fileName := textutil.SlugifyFileName(filepath.Base(path))
+	rc := &record.Record{}
+	if f.PropagateContext {
+		rc.Context = metadata
+	}
+	rc.SetContextValue(string(task.CtxKeyFileNameWrite), fileName)
+	rc.SetContextValue(string(task.CtxKeyFilePathWrite), textutil.SlugifyFilePath(path))
+
+	if f.Stream {
+		return f.streamRecords(ctx, content, rc, output)
+	}
+
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return false, err
+	}
+
+	// let's write content to output channel
+	f.SendData(rc.Context, data, output)
+
+	return true, nil
+
+}
+
 func (f *file) writeFile(input <-chan *record.Record) error {
 
 	for {
@@ -166,46 +235,59 @@ func (f *file) writeFile(input <-chan *record.Record) error {
 			break
 		}
 
-		// Evaluate the path with the record context
-		path, err := f.Path.Get(rc)
-		if err != nil {
+		if err := f.writeRecord(rc); err != nil {
+			if f.DeadLetter(rc, err) {
+				continue
+			}
 			return err
 		}
+	}
 
-		// Determine the scheme from the evaluated path
-		parsedURL, err := url.Parse(path)
-		if err != nil {
-			return err
-		}
-		pathScheme := parsedURL.Scheme
-		if pathScheme == `` {
-			pathScheme = fileScheme
-		}
+	return nil
 
-		var fs file
+}
 
-		fs = *f
-		filePath, found := rc.GetContextValue(string(task.CtxKeyArchiveFileNameWrite))
-		if found {
-			if filePath == "" {
-				log.Fatal("required file path")
-			}
+func (f *file) writeRecord(rc *record.Record) error {
 
-			filePath = strings.ReplaceAll(filePath, "\\", "/")
+	// Evaluate the path with the record context
+	path, err := f.Path.Get(rc)
+	if err != nil {
+		return err
+	}
 
-			fs.Path = f.Path + config.String(filePath)
-		}
+	// Determine the scheme from the evaluated path
+	parsedURL, err := url.Parse(path)
+	if err != nil {
+		return err
+	}
+	pathScheme := parsedURL.Scheme
+	if pathScheme == `` {
+		pathScheme = fileScheme
+	}
 
-		writerFunction, found := writers[pathScheme]
-		if !found {
-			return unknownSchemeError(pathScheme)
-		}
-		if err := writerFunction(&fs, rc, bytes.NewReader(rc.Data)); err != nil {
-			return err
+	fs := &file{
+		Path:             f.Path,
+		Region:           f.Region,
+		StorageClass:     f.StorageClass,
+		Tags:             f.Tags,
+		PropagateContext: f.PropagateContext,
+	}
+	filePath, found := rc.GetContextValue(string(task.CtxKeyArchiveFileNameWrite))
+	if found {
+		if filePath == "" {
+			return fmt.Errorf("required file path")
 		}
+
+		filePath = strings.ReplaceAll(filePath, "\\", "/")
+
+		fs.Path = f.Path + config.String(filePath)
 	}
 
-	return nil
+	writerFunction, found := writers[pathScheme]
+	if !found {
+		return unknownSchemeError(pathScheme)
+	}
+	return writerFunction(fs, rc, bytes.NewReader(rc.Data))
 
 }
 
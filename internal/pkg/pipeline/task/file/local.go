@@ -25,14 +25,14 @@ func newLocalReader(f *file) (reader, error) {
 	return &lclReader, nil
 }
 
-func (r *localReader) read(path string) (io.ReadCloser, error) {
+func (r *localReader) read(path string) (io.ReadCloser, map[string]string, error) {
 
 	inputFile, err := os.Open(path[getPathIndex(path):])
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return inputFile, nil
+	return inputFile, nil, nil
 
 }
 
@@ -10,6 +10,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/patterninc/caterpillar/internal/pkg/config"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
 	s3client "github.com/patterninc/caterpillar/internal/pkg/pipeline/task/file/s3_client"
 )
 
@@ -39,11 +40,11 @@ func newS3Reader(f *file) (reader, error) {
 
 }
 
-func (r *s3Reader) read(path string) (io.ReadCloser, error) {
+func (r *s3Reader) read(path string) (io.ReadCloser, map[string]string, error) {
 
 	bucket, key, err := s3client.ParseURI(path)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	getObjectOutput, err := r.client.GetObject(ctx, &s3.GetObjectInput{
@@ -52,10 +53,10 @@ func (r *s3Reader) read(path string) (io.ReadCloser, error) {
 	})
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return getObjectOutput.Body, nil
+	return getObjectOutput.Body, getObjectOutput.Metadata, nil
 
 }
 
@@ -112,12 +113,19 @@ func writeS3File(f *file, rec *record.Record, reader io.Reader) error {
 		return err
 	}
 
+	// the _SUCCESS marker has no record to take the context of
+	var metadata map[string]string
+	if f.PropagateContext && rec != nil {
+		metadata = task.PropagatedContext(rec)
+	}
+
 	_, err = client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:       &bucket,
 		Key:          &key,
 		Body:         reader,
 		StorageClass: f.StorageClass,
 		Tagging:      tags,
+		Metadata:     metadata,
 	})
 
 	return err
@@ -140,7 +148,7 @@ func buildTags(tags map[string]config.String, rec *record.Record) (*string, erro
 
 	evalRec := rec
 	if evalRec == nil {
-		evalRec = &record.Record{Context: ctx}
+		evalRec = &record.Record{}
 	}
 
 	values := make(url.Values, len(tags))
@@ -0,0 +1,113 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/compress"
+)
+
+const (
+	defaultMaxRecordSize = 64 << 20 // 64 MiB
+	initialBufferSize    = 64 << 10 // 64 KiB
+
+	compressionNone   = `none`
+	compressionAuto   = `auto`
+	compressionGzip   = `gzip`
+	compressionSnappy = `snappy`
+)
+
+// extension → compression format, for compression: auto
+var compressionExtensions = map[string]string{
+	`.gz`:     compressionGzip,
+	`.gzip`:   compressionGzip,
+	`.snappy`: compressionSnappy,
+	`.sz`:     compressionSnappy,
+}
+
+// decompress wraps content in a decompressing reader when compression asks for one
+func (f *file) decompress(path string, content io.Reader) (io.ReadCloser, error) {
+
+	format := f.Compression
+	if format == compressionAuto {
+		format = compressionNone
+		for extension, extensionFormat := range compressionExtensions {
+			if strings.HasSuffix(strings.ToLower(path), extension) {
+				format = extensionFormat
+				break
+			}
+		}
+	}
+
+	if format == compressionNone || format == `` {
+		return io.NopCloser(content), nil
+	}
+
+	return compress.NewReader(format, content)
+
+}
+
+// streamRecords sends a record per delimited chunk of content as it is read, or per
+// max_record_size bytes when the delimiter is empty, so a file never has to fit in
+// memory. It stops early, reporting false, once ctx is done.
+func (f *file) streamRecords(ctx context.Context, content io.Reader, rc *record.Record, output chan<- *record.Record) (bool, error) {
+
+	scanner := bufio.NewScanner(content)
+	scanner.Buffer(make([]byte, 0, min(initialBufferSize, f.MaxRecordSize)), f.MaxRecordSize)
+	if f.Delimiter == `` {
+		scanner.Split(splitSize(f.MaxRecordSize))
+	} else {
+		scanner.Split(splitDelimiter([]byte(f.Delimiter)))
+	}
+
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return false, nil
+		}
+		// the scanner reuses its buffer, so every record gets its own copy
+		f.SendData(rc.Context, bytes.Clone(scanner.Bytes()), output)
+	}
+
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return false, fmt.Errorf("record longer than max_record_size (%d bytes)", f.MaxRecordSize)
+		}
+		return false, err
+	}
+
+	return true, nil
+
+}
+
+// splitDelimiter splits on delimiter, like the split task, dropping a trailing one
+func splitDelimiter(delimiter []byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		if i := bytes.Index(data, delimiter); i >= 0 {
+			return i + len(delimiter), data[:i], nil
+		}
+		if atEOF {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+}
+
+// splitSize splits into chunks of size bytes, the last one possibly shorter
+func splitSize(size int) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if len(data) >= size || (atEOF && len(data) > 0) {
+			n := min(size, len(data))
+			return n, data[:n], nil
+		}
+		return 0, nil, nil
+	}
+}
@@ -0,0 +1,171 @@
+package file
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+)
+
+// Test that content is split into records as it is read, whatever the reads return
+func TestStreamRecords(t *testing.T) {
+	tests := []struct {
+		name          string
+		delimiter     string
+		maxRecordSize int
+		content       io.Reader
+		expected      []string
+		err           string
+	}{
+		{
+			name:          "Lines",
+			delimiter:     "\n",
+			maxRecordSize: defaultMaxRecordSize,
+			content:       strings.NewReader("Ada\nGrace\nAlan\n"),
+			expected:      []string{"Ada", "Grace", "Alan"},
+		},
+		{
+			name:          "Last record without delimiter",
+			delimiter:     "\n",
+			maxRecordSize: defaultMaxRecordSize,
+			content:       strings.NewReader("Ada\nGrace"),
+			expected:      []string{"Ada", "Grace"},
+		},
+		{
+			name:          "Delimiter spanning two reads",
+			delimiter:     "<|>",
+			maxRecordSize: defaultMaxRecordSize,
+			content:       iotest.OneByteReader(strings.NewReader("Ada<|>Grace<|>Alan")),
+			expected:      []string{"Ada", "Grace", "Alan"},
+		},
+		{
+			name:          "Fixed-size chunks without delimiter",
+			maxRecordSize: 4,
+			content:       iotest.HalfReader(strings.NewReader("AdaGraceAlan")),
+			expected:      []string{"AdaG", "race", "Alan"},
+		},
+		{
+			name:          "Last chunk shorter",
+			maxRecordSize: 5,
+			content:       strings.NewReader("AdaGraceAlan"),
+			expected:      []string{"AdaGr", "aceAl", "an"},
+		},
+		{
+			name:          "Record longer than max_record_size",
+			delimiter:     "\n",
+			maxRecordSize: 8,
+			content:       strings.NewReader("Ada\nMargaret Hamilton\nAlan\n"),
+			expected:      []string{"Ada"},
+			err:           "record longer than max_record_size (8 bytes)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &file{Delimiter: tt.delimiter, MaxRecordSize: tt.maxRecordSize}
+			records, complete, err := stream(f, tt.content)
+			assert.Equal(t, tt.expected, records)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				assert.False(t, complete)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, complete)
+		})
+	}
+}
+
+// Test that compression: auto decompresses by the extension of the path
+func TestDecompress(t *testing.T) {
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	_, err := gzipWriter.Write([]byte("Ada\nGrace\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, gzipWriter.Close())
+
+	var snapped bytes.Buffer
+	snappyWriter := snappy.NewBufferedWriter(&snapped)
+	_, err = snappyWriter.Write([]byte("Ada\nGrace\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, snappyWriter.Close())
+
+	tests := []struct {
+		name        string
+		compression string
+		path        string
+		content     []byte
+		expected    []string
+	}{
+		{
+			name:        "Gzip by extension",
+			compression: compressionAuto,
+			path:        "names.txt.gz",
+			content:     gzipped.Bytes(),
+			expected:    []string{"Ada", "Grace"},
+		},
+		{
+			name:        "Gzip by extension in upper case",
+			compression: compressionAuto,
+			path:        "NAMES.TXT.GZ",
+			content:     gzipped.Bytes(),
+			expected:    []string{"Ada", "Grace"},
+		},
+		{
+			name:        "Snappy by extension",
+			compression: compressionAuto,
+			path:        "names.txt.snappy",
+			content:     snapped.Bytes(),
+			expected:    []string{"Ada", "Grace"},
+		},
+		{
+			name:        "Plain without a known extension",
+			compression: compressionAuto,
+			path:        "names.txt",
+			content:     []byte("Ada\nGrace\n"),
+			expected:    []string{"Ada", "Grace"},
+		},
+		{
+			name:        "Compression set regardless of extension",
+			compression: compressionGzip,
+			path:        "names.txt",
+			content:     gzipped.Bytes(),
+			expected:    []string{"Ada", "Grace"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &file{Delimiter: defaultDelimiter, MaxRecordSize: defaultMaxRecordSize, Compression: tt.compression}
+			content, err := f.decompress(tt.path, bytes.NewReader(tt.content))
+			assert.NoError(t, err)
+			defer content.Close()
+
+			records, complete, err := stream(f, content)
+			assert.NoError(t, err)
+			assert.True(t, complete)
+			assert.Equal(t, tt.expected, records)
+		})
+	}
+}
+
+// stream returns the data of the records f streams from content
+func stream(f *file, content io.Reader) ([]string, bool, error) {
+	output := make(chan *record.Record, 100)
+	complete, err := f.streamRecords(context.Background(), content, &record.Record{}, output)
+	close(output)
+
+	var records []string
+	for r := range output {
+		records = append(records, string(r.Data))
+	}
+	return records, complete, err
+}
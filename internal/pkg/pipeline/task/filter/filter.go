@@ -0,0 +1,66 @@
+package filter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/patterninc/caterpillar/internal/pkg/config"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+)
+
+var (
+	ErrIncorrectInputOutput = fmt.Errorf(`input and output channels must be provided`)
+)
+
+type filter struct {
+	task.Base `yaml:",inline" json:",inline"`
+	When      config.String `yaml:"when,omitempty" json:"when,omitempty" validate:"required"`
+	Invert    bool          `yaml:"invert,omitempty" json:"invert,omitempty"`
+}
+
+func New() (task.Task, error) {
+	return &filter{}, nil
+}
+
+// Positions returns where the task can run: it needs both input and output
+func (f *filter) Positions() task.Position {
+	return task.PositionMiddle
+}
+
+func (f *filter) Run(_ context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
+
+	if input == nil || output == nil {
+		return ErrIncorrectInputOutput
+	}
+
+	for {
+		r, ok := f.GetRecord(input)
+		if !ok {
+			break
+		}
+
+		query, err := f.When.GetJQ(r)
+		if err != nil {
+			if f.DeadLetter(r, err) {
+				continue
+			}
+			return err
+		}
+
+		matched, err := query.Match(r.Data)
+		if err != nil {
+			if f.DeadLetter(r, err) {
+				continue
+			}
+			return err
+		}
+
+		if matched != f.Invert {
+			f.SendRecord(r, output)
+		}
+	}
+
+	return nil
+
+}
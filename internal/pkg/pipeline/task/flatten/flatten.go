@@ -1,6 +1,7 @@
 package flatten
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
@@ -16,7 +17,7 @@ func New() (task.Task, error) {
 	return &flatten{}, nil
 }
 
-func (f *flatten) Run(input <-chan *record.Record, output chan<- *record.Record) error {
+func (f *flatten) Run(_ context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
 
 	for {
 		r, ok := f.GetRecord(input)
@@ -26,6 +27,9 @@ func (f *flatten) Run(input <-chan *record.Record, output chan<- *record.Record)
 
 		var data map[string]any
 		if err := json.Unmarshal(r.Data, &data); err != nil {
+			if f.DeadLetter(r, err) {
+				continue
+			}
 			return err
 		}
 
@@ -1,6 +1,7 @@
 package heimdall
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -56,7 +57,7 @@ func New() (task.Task, error) {
 	return h, nil
 }
 
-func (h *heimdall) Run(input <-chan *record.Record, output chan<- *record.Record) (err error) {
+func (h *heimdall) Run(_ context.Context, input <-chan *record.Record, output chan<- *record.Record) (err error) {
 
 	// If input is provided, override the job request context
 	if input != nil {
@@ -69,16 +70,22 @@ func (h *heimdall) Run(input <-chan *record.Record, output chan<- *record.Record
 			// Parse the input record to get dynamic context
 			var jobContext map[string]any
 			if err := json.Unmarshal([]byte(rc.Data), &jobContext); err != nil {
+				if h.DeadLetter(rc, err) {
+					continue
+				}
 				return err
 			}
 
 			// Create a job request with the dynamic context
 			jobReq := h.buildJobRequest(jobContext)
 			if err := h.submitJob(jobReq, output); err != nil {
+				if h.DeadLetter(rc, err) {
+					continue
+				}
 				if !h.SkipOnError {
 					return err
 				}
-				fmt.Printf("WARN: skipping failed record in %s: %s\n", h.GetName(), err)
+				h.RecordLogger(rc).Warn(`skipping failed record`, `error`, err)
 				continue
 			}
 		}
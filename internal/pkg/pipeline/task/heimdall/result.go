@@ -1,16 +1,11 @@
 package heimdall
 
 import (
-	"context"
 	"encoding/json"
 
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
 )
 
-var (
-	ctx = context.Background()
-)
-
 type result struct {
 	Columns []*column `yaml:"columns,omitempty" json:"columns,omitempty"`
 	Data    [][]any   `yaml:"data,omitempty" json:"data,omitempty"`
@@ -54,7 +49,7 @@ func (h *heimdall) sendToOutput(result *result, output chan<- *record.Record) er
 	}
 
 	for _, item := range items {
-		h.SendData(ctx, item, output)
+		h.SendData(nil, item, output)
 	}
 
 	return nil
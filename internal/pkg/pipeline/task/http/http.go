@@ -28,6 +28,7 @@ const (
 	defaultMethod           = http.MethodGet
 	defaultTimeout          = duration.Duration(90 * time.Second)
 	headerContextPrefix     = "http-header-%s"
+	pageIDVariable          = `$page_id`
 )
 
 var (
@@ -51,6 +52,18 @@ type httpCore struct {
 	clientOnce       sync.Once
 }
 
+// cursor is where pagination stands after a page; it is the unit checkpointed
+// for a source http task, so a resumed run starts from the page after it
+type cursor struct {
+	Endpoint string            `json:"endpoint,omitempty"`
+	Method   string            `json:"method,omitempty"`
+	Body     string            `json:"body,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	PageID   int               `json:"page_id,omitempty"`
+	Context  map[string]string `json:"context,omitempty"`
+	Done     bool              `json:"done,omitempty"`
+}
+
 type result struct {
 	Data    string              `json:"data"`
 	Headers map[string][]string `json:"headers"`
@@ -128,7 +141,20 @@ func (h *httpCore) newFromInput(data []byte) (*httpCore, error) {
 
 }
 
-func (h *httpCore) Run(input <-chan *record.Record, output chan<- *record.Record) (err error) {
+// ContextKeys returns the context keys set on the records sent: one per response
+// header, and whatever next_page sets, which is only known at runtime
+func (h *httpCore) ContextKeys() []string {
+
+	keys := []string{fmt.Sprintf(headerContextPrefix, `*`)}
+	if h.NextPage != nil {
+		keys = append(keys, `*`)
+	}
+
+	return keys
+
+}
+
+func (h *httpCore) Run(ctx context.Context, input <-chan *record.Record, output chan<- *record.Record) (err error) {
 
 	// if we have input, treat each value as a URL and try to get data from it...
 	if input != nil {
@@ -141,20 +167,28 @@ func (h *httpCore) Run(input <-chan *record.Record, output chan<- *record.Record
 			// let's get our http object
 			newHttp, err := h.newFromInput(rc.Data)
 			if err != nil {
+				if h.DeadLetter(rc, err) {
+					continue
+				}
 				return err
 			}
-			if err := newHttp.processItem(rc, output); err != nil {
+			// records already in flight are paged to the end, even on shutdown
+			if err := newHttp.processItem(context.Background(), rc, output); err != nil {
+				if h.DeadLetter(rc, err) {
+					continue
+				}
 				return err
 			}
 		}
 	}
 
 	// now we'll process the task configured item itself...
-	return h.processItem(nil, output)
+	return h.processItem(ctx, nil, output)
 
 }
 
-func (h *httpCore) processItem(rc *record.Record, output chan<- *record.Record) error {
+// processItem requests endpoint and follows next_page until it runs out or ctx is done.
+func (h *httpCore) processItem(ctx context.Context, rc *record.Record, output chan<- *record.Record) error {
 
 	// let's set the endpoint from which we start
 	endpoint := h.Endpoint
@@ -164,14 +198,42 @@ func (h *httpCore) processItem(rc *record.Record, output chan<- *record.Record)
 		return nil
 	}
 
+	// only the task's own endpoint is checkpointed, not the ones it gets as input
+	var checkpoint task.Checkpoint
+	if rc == nil {
+		checkpoint = h.Checkpoint()
+	}
+
 	// create a default record context if none provided
 	if rc == nil {
-		rc = &record.Record{Context: context.Background()}
+		rc = &record.Record{}
 	}
 
 	// TODO: perhaps expose the starting page number as a parameter for the task
 	pageID := 1
 
+	// context set by next_page, kept so it can be restored on resume
+	pageContext := make(map[string]string)
+
+	if checkpoint != nil {
+		if unit, found := checkpoint.Last(); found {
+			last := &cursor{}
+			if err := json.Unmarshal([]byte(unit), last); err != nil {
+				return fmt.Errorf("cannot parse checkpoint cursor: %w", err)
+			}
+			if last.Done {
+				h.Logger().Info(`all pages completed by an earlier run`)
+				return nil
+			}
+			endpoint, h.Method, h.Body, h.Headers, pageID = last.Endpoint, last.Method, last.Body, last.Headers, last.PageID
+			for name, value := range last.Context {
+				rc.SetContextValue(name, value)
+				pageContext[name] = value
+			}
+			h.Logger().Info(`resuming pagination`, `endpoint`, endpoint, `page_id`, pageID)
+		}
+	}
+
 	// we have infinite loop to account for potential pagination
 	for {
 		result, err := h.call(endpoint, rc)
@@ -199,7 +261,7 @@ func (h *httpCore) processItem(rc *record.Record, output chan<- *record.Record)
 		// we move to the next page
 		pageID++
 
-		nextPage, err := h.NextPage.GetJQ(rc)
+		nextPage, err := h.NextPage.GetJQ(rc, pageIDVariable)
 		if err != nil {
 			return err
 		}
@@ -207,9 +269,7 @@ func (h *httpCore) processItem(rc *record.Record, output chan<- *record.Record)
 		if err != nil {
 			return err
 		}
-		nextPageData, err := nextPage.Execute(nextPageInput, map[string]any{
-			`page_id`: pageID,
-		})
+		nextPageData, err := nextPage.Execute(nextPageInput, pageID)
 
 		if err != nil {
 			return err
@@ -259,15 +319,48 @@ func (h *httpCore) processItem(rc *record.Record, output chan<- *record.Record)
 						return fmt.Errorf("cannot set context value %s: %s", name, err)
 					}
 					rc.SetContextValue(name, string(encoded))
+					pageContext[name] = string(encoded)
 				}
 			}
 		} else {
 			break
 		}
 
+		// record where to pick up from, then stop here if we are shutting down
+		if err := h.checkpointPage(checkpoint, &cursor{
+			Endpoint: endpoint,
+			Method:   h.Method,
+			Body:     h.Body,
+			Headers:  h.Headers,
+			PageID:   pageID,
+			Context:  pageContext,
+		}); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
 	}
 
-	return nil
+	// pages ran out
+	return h.checkpointPage(checkpoint, &cursor{Done: true})
+
+}
+
+func (h *httpCore) checkpointPage(checkpoint task.Checkpoint, next *cursor) error {
+
+	if checkpoint == nil {
+		return nil
+	}
+
+	unit, err := json.Marshal(next)
+	if err != nil {
+		return err
+	}
+
+	// only the latest cursor is needed to pick up from
+	return checkpoint.Advance(string(unit))
 
 }
 
@@ -291,6 +384,11 @@ func (h *httpCore) call(endpoint string, rc *record.Record) (*result, error) {
 			request.Header.Set(k, v)
 		}
 
+		// the trace of the record goes on in the service called
+		if traceParent, found := rc.GetContextValue(string(task.CtxKeyTraceParent)); found {
+			request.Header.Set(string(task.CtxKeyTraceParent), traceParent)
+		}
+
 		// TODO: support multiple "behaviors" for oauth support
 		if h.Oauth != nil {
 			if err := h.oauth(endpoint, request, rc); err != nil {
@@ -1,12 +1,12 @@
 package server
 
 import (
-	"context"
 	"encoding/json"
 	"io"
 	"net/http"
 
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
 )
 
 const (
@@ -17,7 +17,6 @@ const (
 )
 
 var (
-	ctx       = context.Background()
 	okMessage = []byte(`{"ok":true}`)
 )
 
@@ -65,8 +64,12 @@ func (s *server) createPathHandler(pathConfig pathConfig, output chan<- *record.
 			return
 		}
 
-		// create a new record with the request information
-		s.SendData(ctx, jsonData, output)
+		// create a new record with the request information, going on with the trace of the caller
+		rc := &record.Record{}
+		if traceParent := r.Header.Get(string(task.CtxKeyTraceParent)); traceParent != `` {
+			rc.SetContextValue(string(task.CtxKeyTraceParent), traceParent)
+		}
+		s.SendData(rc.Context, jsonData, output)
 
 		w.Header().Set(contentTypeKey, contentTypeJson)
 		w.WriteHeader(http.StatusOK)
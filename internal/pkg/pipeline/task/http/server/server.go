@@ -52,13 +52,17 @@ func New() (task.Task, error) {
 // Init prints a warning if task_concurrency is set for http_server
 func (s *server) GetTaskConcurrency() int {
 	if s.Base.TaskConcurrency > 1 {
-		fmt.Printf("WARN: task_concurrency (%d) is not supported for task '%s'. Only one server instance will run.\n",
-			s.Base.TaskConcurrency, s.Base.Type)
+		s.Logger().Warn(`task_concurrency is not supported, only one server instance will run`, `task_concurrency`, s.Base.TaskConcurrency)
 	}
 	return 1
 }
 
-func (s *server) Run(input <-chan *record.Record, output chan<- *record.Record) error {
+// Positions returns where the task can run: the server only produces records
+func (s *server) Positions() task.Position {
+	return task.PositionFirst
+}
+
+func (s *server) Run(ctx context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
 
 	// input channel must be nil
 	if input != nil {
@@ -95,18 +99,26 @@ func (s *server) Run(input <-chan *record.Record, output chan<- *record.Record)
 		Handler:      h,
 	}
 
-	// if we have server shutdown requirement, let's set the timer...
+	// we shut the server down with the pipeline, or after a while if end_after is set
+	var cancel context.CancelFunc
 	if s.EndAfter > 0 {
-		go func() {
-			time.Sleep(time.Duration(s.EndAfter))
-			contextWithTimeout, cancel := context.WithTimeout(ctx, time.Duration(s.ReadTimeout*2))
-			defer cancel()
-			if err := server.Shutdown(contextWithTimeout); err != nil {
-				// TODO: add proper error loging
-				fmt.Println("Server Shutdown Error:", err)
-			}
-		}()
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(s.EndAfter))
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
 	}
+	defer cancel()
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		// requests in flight are allowed to finish, so their records still go downstream
+		contextWithTimeout, cancel := context.WithTimeout(context.Background(), time.Duration(s.ReadTimeout*2))
+		defer cancel()
+		if err := server.Shutdown(contextWithTimeout); err != nil {
+			s.Logger().Error(`server shutdown failed`, `error`, err)
+		}
+	}()
 
 	if err := server.ListenAndServe(); err != nil {
 		if err != http.ErrServerClosed {
@@ -114,6 +126,10 @@ func (s *server) Run(input <-chan *record.Record, output chan<- *record.Record)
 		}
 	}
 
+	// Shutdown returns once in-flight requests are done, so no handler is still
+	// sending when the pipeline closes our output
+	<-shutdownDone
+
 	return nil
 
 }
@@ -16,10 +16,6 @@ const (
 	defaultBufferSize = 1000000
 )
 
-var (
-	ctx = context.Background()
-)
-
 var (
 	ErrIncorrectInputOutput = fmt.Errorf(`input and output channels must be provided`)
 )
@@ -38,7 +34,12 @@ func New() (task.Task, error) {
 	}, nil
 }
 
-func (j *join) Run(input <-chan *record.Record, output chan<- *record.Record) error {
+// Positions returns where the task can run: it needs both input and output
+func (j *join) Positions() task.Position {
+	return task.PositionMiddle
+}
+
+func (j *join) Run(_ context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
 
 	if input == nil || output == nil {
 		return ErrIncorrectInputOutput
@@ -102,6 +103,6 @@ func (j *join) sendJoinedRecords(buffer []*record.Record, output chan<- *record.
 		joinedData.Write(r.Data)
 	}
 
-	j.SendData(ctx, []byte(joinedData.String()), output)
+	j.SendData(nil, []byte(joinedData.String()), output)
 
 }
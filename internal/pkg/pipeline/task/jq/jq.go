@@ -1,6 +1,7 @@
 package jq
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -21,7 +22,7 @@ func New() (task.Task, error) {
 	return &jq{IgnoreError: true}, nil
 }
 
-func (j *jq) Run(input <-chan *record.Record, output chan<- *record.Record) (err error) {
+func (j *jq) Run(_ context.Context, input <-chan *record.Record, output chan<- *record.Record) (err error) {
 
 	if input != nil && output != nil {
 		for {
@@ -33,6 +34,9 @@ func (j *jq) Run(input <-chan *record.Record, output chan<- *record.Record) (err
 			// First evaluate config templates in the path
 			query, err := j.Path.GetJQ(r)
 			if err != nil {
+				if j.DeadLetter(r, err) {
+					continue
+				}
 				return err
 			}
 
@@ -42,9 +46,13 @@ func (j *jq) Run(input <-chan *record.Record, output chan<- *record.Record) (err
 				// An ignored query error costs only its own record, since it describes
 				// that record rather than the pipeline, and warns because the run is not
 				// failing over it. Otherwise it is critical: return, and let fail_on_error
-				// judge the verdict as it does for every other task.
+				// judge the verdict as it does for every other task. A dead_letter route
+				// takes precedence, since the record is then kept rather than lost.
+				if j.DeadLetter(r, err) {
+					continue
+				}
 				if j.IgnoreError {
-					fmt.Printf("WARN: %s: skipping record %d: %s\n", j.GetName(), r.ID, err)
+					j.RecordLogger(r).Warn(`skipping record`, `error`, err)
 					continue
 				}
 				return err
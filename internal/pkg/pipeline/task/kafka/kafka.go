@@ -3,6 +3,9 @@ package kafka
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
+	"strconv"
 	"sync"
 	"time"
 
@@ -24,6 +27,12 @@ const (
 
 	// standaloneGroupPrefix is the group.id used for direct-assign reads (no group_id set); broker needs PREFIXED ACL on this prefix.
 	standaloneGroupPrefix = "caterpillar-standalone-"
+
+	// context keys set on the records read with propagate_context, besides the headers of the message
+	topicContextKey     = "kafka-topic"
+	partitionContextKey = "kafka-partition"
+	offsetContextKey    = "kafka-offset"
+	keyContextKey       = "kafka-key"
 )
 
 // schemaRegistryConfig holds Schema Registry connection details; required when format is "avro".
@@ -53,6 +62,7 @@ type kafka struct {
 	RetryLimit         *int                 `yaml:"retry_limit,omitempty" json:"retry_limit,omitempty"`                                                        // number of retries for read errors
 	Idempotent         bool                 `yaml:"idempotent,omitempty" json:"idempotent,omitempty"`                                                          // enable idempotent producer
 	Format             string               `yaml:"format,omitempty" json:"format,omitempty"`                                                                  // message format: "json" (default) or "avro"
+	PropagateContext   bool                 `yaml:"propagate_context,omitempty" json:"propagate_context,omitempty"`                                            // write the record context as message headers, and read it back from them
 	SchemaRegistry     schemaRegistryConfig `yaml:",inline" json:",inline"`                                                                                    // Schema Registry connection — required when format is "avro"
 }
 
@@ -60,13 +70,35 @@ func New() (task.Task, error) {
 	return &kafka{}, nil
 }
 
-func (k *kafka) Init() error {
+// Check validates the configuration without connecting to the brokers
+func (k *kafka) Check() error {
 	if k.BootstrapServer == "" {
 		return fmt.Errorf("bootstrap_server is required")
 	}
 	if k.Topic == "" {
 		return fmt.Errorf("topic is required")
 	}
+	return nil
+}
+
+// Positions returns where the task can run: kafka either reads or writes records
+func (k *kafka) Positions() task.Position {
+	return task.PositionFirst | task.PositionLast
+}
+
+// ContextKeys returns the context keys set on the records read: with
+// propagate_context, any header of the messages
+func (k *kafka) ContextKeys() []string {
+	if !k.PropagateContext {
+		return nil
+	}
+	return []string{"*"}
+}
+
+func (k *kafka) Init() error {
+	if err := k.Check(); err != nil {
+		return err
+	}
 	if k.Timeout <= 0 {
 		k.Timeout = defaultTimeout
 	}
@@ -108,7 +140,7 @@ func (k *kafka) Init() error {
 	return nil
 }
 
-func (k *kafka) Run(input <-chan *record.Record, output chan<- *record.Record) error {
+func (k *kafka) Run(ctx context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
 	if input != nil && output != nil {
 		return task.ErrPresentInputOutput
 	}
@@ -117,7 +149,7 @@ func (k *kafka) Run(input <-chan *record.Record, output chan<- *record.Record) e
 		return k.write(input)
 	}
 
-	return k.read(context.Background(), output)
+	return k.read(ctx, output)
 }
 
 // write produces records to the Kafka topic using the codec selected by the format field.
@@ -150,8 +182,7 @@ func (k *kafka) write(input <-chan *record.Record) error {
 		for e := range deliveryCh {
 			if m, ok := e.(*ckafka.Message); ok && m.TopicPartition.Error != nil && firstDeliveryErr == nil {
 				firstDeliveryErr = m.TopicPartition.Error
-				fmt.Printf("delivery failed for topic %s partition %d: %v\n",
-					k.Topic, m.TopicPartition.Partition, m.TopicPartition.Error)
+				k.Logger().Error(`delivery failed`, `topic`, k.Topic, `partition`, m.TopicPartition.Partition, `error`, m.TopicPartition.Error)
 			}
 		}
 	}()
@@ -172,6 +203,7 @@ func (k *kafka) write(input <-chan *record.Record) error {
 		if err = p.Produce(&ckafka.Message{
 			TopicPartition: ckafka.TopicPartition{Topic: &k.Topic, Partition: ckafka.PartitionAny},
 			Value:          msgBytes,
+			Headers:        k.headers(r),
 		}, deliveryCh); err != nil {
 			produceErr = fmt.Errorf("failed to enqueue message to topic %s: %w", k.Topic, err)
 			break
@@ -199,7 +231,7 @@ func (k *kafka) write(input <-chan *record.Record) error {
 	return nil
 }
 
-// read polls messages from the topic, standalone mode reads from beginning on every run, group mode resumes from committed offsets.
+// read polls messages from the topic until ctx is done (shutdown or end_after), standalone mode reads from beginning on every run, group mode resumes from committed offsets.
 func (k *kafka) read(ctx context.Context, output chan<- *record.Record) error {
 	if k.EndAfter > 0 {
 		var cancel context.CancelFunc
@@ -226,12 +258,12 @@ func (k *kafka) read(ctx context.Context, output chan<- *record.Record) error {
 	}
 	defer func() {
 		if err := c.Close(); err != nil {
-			fmt.Printf("warning: error closing kafka consumer: %v\n", err)
+			k.Logger().Warn(`error closing kafka consumer`, `error`, err)
 		}
 	}()
 
 	if standalone {
-		fmt.Printf("no group_id set — standalone read from beginning of topic %s\n", k.Topic)
+		k.Logger().Info(`no group_id set, standalone read from beginning of topic`, `topic`, k.Topic)
 		if err := k.assignAllPartitions(c); err != nil {
 			return fmt.Errorf("failed to assign partitions: %w", err)
 		}
@@ -252,7 +284,11 @@ func (k *kafka) read(ctx context.Context, output chan<- *record.Record) error {
 	for {
 		select {
 		case <-ctx.Done():
-			fmt.Printf("kafka end_after duration reached for topic %s, stopping reader\n", k.Topic)
+			if ctx.Err() == context.DeadlineExceeded {
+				k.Logger().Info(`kafka end_after duration reached, stopping reader`, `topic`, k.Topic)
+			} else {
+				k.Logger().Info(`kafka reader is shutting down`, `topic`, k.Topic)
+			}
 			return nil
 		default:
 		}
@@ -261,16 +297,16 @@ func (k *kafka) read(ctx context.Context, output chan<- *record.Record) error {
 		if err != nil {
 			if kafkaErr, ok := err.(ckafka.Error); ok && kafkaErr.Code() == ckafka.ErrTimedOut {
 				retriesNumber++
-				fmt.Printf("kafka read timeout for attempt #%d on topic %s\n", retriesNumber, k.Topic)
+				k.Logger().Debug(`kafka read timeout`, `attempt`, retriesNumber, `topic`, k.Topic)
 			} else if !k.shouldRetry(err) {
 				return err
 			} else {
 				retriesNumber++
-				fmt.Printf("kafka error reading message attempt #%d: %v\n", retriesNumber, err)
+				k.Logger().Warn(`kafka error reading message`, `attempt`, retriesNumber, `topic`, k.Topic, `error`, err)
 			}
 
 			if retriesNumber > *k.RetryLimit {
-				fmt.Printf("kafka error while reading message, reached retry limit (%d), stopping reader\n", *k.RetryLimit)
+				k.Logger().Info(`kafka reached retry limit, stopping reader`, `retry_limit`, *k.RetryLimit, `topic`, k.Topic)
 				return nil
 			}
 			continue
@@ -282,24 +318,66 @@ func (k *kafka) read(ctx context.Context, output chan<- *record.Record) error {
 			return fmt.Errorf("failed to deserialize message from topic %s: %w", k.Topic, err)
 		}
 
-		k.SendData(ctx, data, output)
+		k.SendData(k.messageContext(msg), data, output)
 
 		// Only store offsets for group consumers — standalone reads never commit.
 		if !standalone {
 			if _, err := c.StoreMessage(msg); err != nil {
-				fmt.Printf("warning: failed to store offset for topic %s partition %d: %v\n",
-					k.Topic, msg.TopicPartition.Partition, err)
+				k.Logger().Warn(`failed to store offset`, `topic`, k.Topic, `partition`, msg.TopicPartition.Partition, `error`, err)
 			}
 		}
 
 		recordsRead++
 		if k.MaxRecords > 0 && recordsRead >= k.MaxRecords {
-			fmt.Printf("kafka max_records (%d) reached for topic %s, stopping reader\n", k.MaxRecords, k.Topic)
+			k.Logger().Info(`kafka max_records reached, stopping reader`, `max_records`, k.MaxRecords, `topic`, k.Topic)
 			return nil
 		}
 	}
 }
 
+// headers returns the context of r as message headers with propagate_context,
+// and otherwise its trace, if any
+func (k *kafka) headers(r *record.Record) []ckafka.Header {
+	if !k.PropagateContext {
+		if traceParent, found := r.GetContextValue(string(task.CtxKeyTraceParent)); found {
+			return []ckafka.Header{{Key: string(task.CtxKeyTraceParent), Value: []byte(traceParent)}}
+		}
+		return nil
+	}
+	values := task.PropagatedContext(r)
+	headers := make([]ckafka.Header, 0, len(values))
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		headers = append(headers, ckafka.Header{Key: key, Value: []byte(values[key])})
+	}
+	return headers
+}
+
+// messageContext returns the headers of msg as record context, with where msg was read from, with propagate_context;
+// otherwise only the trace of msg, if any
+func (k *kafka) messageContext(msg *ckafka.Message) record.Metadata {
+	if !k.PropagateContext {
+		for _, header := range msg.Headers {
+			if header.Key == string(task.CtxKeyTraceParent) {
+				return record.Metadata{header.Key: string(header.Value)}
+			}
+		}
+		return nil
+	}
+	values := make(record.Metadata, len(msg.Headers)+4)
+	for _, header := range msg.Headers {
+		values[header.Key] = string(header.Value)
+	}
+	if msg.TopicPartition.Topic != nil {
+		values[topicContextKey] = *msg.TopicPartition.Topic
+	}
+	values[partitionContextKey] = strconv.Itoa(int(msg.TopicPartition.Partition))
+	values[offsetContextKey] = msg.TopicPartition.Offset.String()
+	if msg.Key != nil {
+		values[keyContextKey] = string(msg.Key)
+	}
+	return values
+}
+
 func (k *kafka) newCodec() (messageCodec, error) {
 	return newCodecForFormat(k.Format, k.SchemaRegistry)
 }
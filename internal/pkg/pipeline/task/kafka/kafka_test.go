@@ -0,0 +1,125 @@
+package kafka
+
+import (
+	"testing"
+
+	ckafka "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+)
+
+const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// Test that the context of a record goes as message headers, sorted by key
+func TestHeaders(t *testing.T) {
+	tests := []struct {
+		name             string
+		propagateContext bool
+		context          map[string]string
+		expected         []ckafka.Header
+	}{
+		{
+			name:    "Context not propagated",
+			context: map[string]string{"user_id": "42"},
+		},
+		{
+			name:    "Trace without context",
+			context: map[string]string{"user_id": "42", string(task.CtxKeyTraceParent): traceParent},
+			expected: []ckafka.Header{
+				{Key: string(task.CtxKeyTraceParent), Value: []byte(traceParent)},
+			},
+		},
+		{
+			name:             "Context propagated",
+			propagateContext: true,
+			context: map[string]string{
+				"user_id":                        "42",
+				"empty":                          "",
+				string(task.CtxKeyFileNameWrite): "users.json",
+				string(task.CtxKeyTraceParent):   traceParent,
+			},
+			expected: []ckafka.Header{
+				{Key: "empty", Value: []byte("")},
+				{Key: string(task.CtxKeyTraceParent), Value: []byte(traceParent)},
+				{Key: "user_id", Value: []byte("42")},
+			},
+		},
+		{
+			name:             "No context",
+			propagateContext: true,
+			expected:         []ckafka.Header{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := &kafka{PropagateContext: tt.propagateContext}
+			r := &record.Record{}
+			for key, value := range tt.context {
+				r.SetContextValue(key, value)
+			}
+			assert.Equal(t, tt.expected, k.headers(r))
+		})
+	}
+}
+
+// Test that the headers of a message come back as record context, with where it was read from
+func TestMessageContext(t *testing.T) {
+	topic := "users"
+	message := &ckafka.Message{
+		TopicPartition: ckafka.TopicPartition{Topic: &topic, Partition: 3, Offset: 42},
+		Key:            []byte("ada"),
+		Headers: []ckafka.Header{
+			{Key: "user_id", Value: []byte("42")},
+			{Key: string(task.CtxKeyTraceParent), Value: []byte(traceParent)},
+		},
+	}
+
+	tests := []struct {
+		name             string
+		propagateContext bool
+		message          *ckafka.Message
+		expected         record.Metadata
+	}{
+		{
+			name:     "Trace without context",
+			message:  message,
+			expected: record.Metadata{string(task.CtxKeyTraceParent): traceParent},
+		},
+		{
+			name:    "No trace without context",
+			message: &ckafka.Message{Headers: []ckafka.Header{{Key: "user_id", Value: []byte("42")}}},
+		},
+		{
+			name:             "Context propagated",
+			propagateContext: true,
+			message:          message,
+			expected: record.Metadata{
+				"user_id":                      "42",
+				string(task.CtxKeyTraceParent): traceParent,
+				topicContextKey:                "users",
+				partitionContextKey:            "3",
+				offsetContextKey:               "42",
+				keyContextKey:                  "ada",
+			},
+		},
+		{
+			name:             "Message without topic or key",
+			propagateContext: true,
+			message:          &ckafka.Message{TopicPartition: ckafka.TopicPartition{Partition: 0, Offset: 7}},
+			expected: record.Metadata{
+				partitionContextKey: "0",
+				offsetContextKey:    "7",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := &kafka{PropagateContext: tt.propagateContext}
+			assert.Equal(t, tt.expected, k.messageContext(tt.message))
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+)
+
+type memory struct {
+	task.Base `yaml:",inline" json:",inline"`
+	Records   []*inlineRecord `yaml:"records,omitempty" json:"records,omitempty"`
+
+	// records handed over by Go callers, sent after those of the configuration
+	fed   []*record.Record
+	mutex sync.Mutex
+}
+
+// inlineRecord is a record written in the configuration
+type inlineRecord struct {
+	Data    any             `yaml:"data" json:"data"`
+	Context record.Metadata `yaml:"context,omitempty" json:"context,omitempty"`
+}
+
+func New() (task.Task, error) {
+	return &memory{}, nil
+}
+
+func (m *memory) Init() error {
+
+	for i, r := range m.Records {
+		if r == nil {
+			return fmt.Errorf("record %d must not be empty", i+1)
+		}
+		if _, err := Data(r.Data); err != nil {
+			return fmt.Errorf("record %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+
+}
+
+// Positions returns where the task can run: it is a source
+func (m *memory) Positions() task.Position {
+	return task.PositionFirst
+}
+
+// ContextKeys returns the keys the records of the configuration set
+func (m *memory) ContextKeys() []string {
+
+	var keys []string
+	for _, r := range m.Records {
+		for key := range r.Context {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+
+}
+
+// Feed hands records to the task; it must be called before the pipeline runs
+func (m *memory) Feed(records ...*record.Record) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.fed = append(m.fed, records...)
+
+}
+
+func (m *memory) Run(ctx context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
+
+	if input != nil {
+		return task.ErrPresentInput
+	}
+	if output == nil {
+		return task.ErrNilOutput
+	}
+
+	for _, r := range m.Records {
+		if ctx.Err() != nil {
+			return nil
+		}
+		data, err := Data(r.Data)
+		if err != nil {
+			return err
+		}
+		m.SendData(r.Context, data, output)
+	}
+
+	m.mutex.Lock()
+	fed := m.fed
+	m.mutex.Unlock()
+
+	for _, r := range fed {
+		if ctx.Err() != nil {
+			return nil
+		}
+		m.SendData(r.Context, r.Data, output)
+	}
+
+	return nil
+
+}
+
+// Data returns the data of a record written in the configuration: strings as
+// they are, other values as JSON
+func Data(value any) ([]byte, error) {
+
+	if s, ok := value.(string); ok {
+		return []byte(s), nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal data: %w", err)
+	}
+
+	return data, nil
+
+}
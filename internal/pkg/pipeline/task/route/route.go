@@ -0,0 +1,120 @@
+package route
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/patterninc/caterpillar/internal/pkg/config"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+)
+
+var (
+	ErrIncorrectInputOutput = fmt.Errorf(`input and output channels must be provided`)
+)
+
+type route struct {
+	task.Base `yaml:",inline" json:",inline"`
+	Routes    []*branch `yaml:"routes,omitempty" json:"routes,omitempty" validate:"required,min=1,dive"`
+	Default   string    `yaml:"default,omitempty" json:"default,omitempty"`
+}
+
+// branch sends the records matching When to the branch headed by task To
+type branch struct {
+	When config.String `yaml:"when,omitempty" json:"when,omitempty" validate:"required"`
+	To   string        `yaml:"to,omitempty" json:"to,omitempty" validate:"required"`
+}
+
+func New() (task.Task, error) {
+	return &route{}, nil
+}
+
+func (r *route) Init() error {
+
+	for _, b := range r.Routes {
+		if b.To == r.Name {
+			return fmt.Errorf("route cannot send records to itself")
+		}
+	}
+	if r.Default == r.Name && r.Default != `` {
+		return fmt.Errorf("route cannot send records to itself")
+	}
+
+	return nil
+
+}
+
+// Targets returns the tasks records can be sent to
+func (r *route) Targets() []string {
+
+	targets := make([]string, 0, len(r.Routes)+1)
+	for _, b := range r.Routes {
+		targets = append(targets, b.To)
+	}
+	if r.Default != `` {
+		targets = append(targets, r.Default)
+	}
+
+	return targets
+
+}
+
+// Positions returns where the task can run: it needs both input and output
+func (r *route) Positions() task.Position {
+	return task.PositionMiddle
+}
+
+func (r *route) Run(_ context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
+
+	if input == nil || output == nil {
+		return ErrIncorrectInputOutput
+	}
+
+	for {
+		rc, ok := r.GetRecord(input)
+		if !ok {
+			break
+		}
+
+		target, err := r.match(rc)
+		if err != nil {
+			if r.DeadLetter(rc, err) {
+				continue
+			}
+			return err
+		}
+		if target == `` {
+			r.RecordLogger(rc).Debug(`dropping record matching no route`)
+			continue
+		}
+
+		rc.SetContextValue(string(task.CtxKeyRoute), target)
+		r.SendRecord(rc, output)
+	}
+
+	return nil
+
+}
+
+// match returns the task of the first route whose predicate holds, the default
+// when none does
+func (r *route) match(rc *record.Record) (string, error) {
+
+	for _, b := range r.Routes {
+		query, err := b.When.GetJQ(rc)
+		if err != nil {
+			return ``, err
+		}
+
+		matched, err := query.Match(rc.Data)
+		if err != nil {
+			return ``, fmt.Errorf("route to %s: %w", b.To, err)
+		}
+		if matched {
+			return b.To, nil
+		}
+	}
+
+	return r.Default, nil
+
+}
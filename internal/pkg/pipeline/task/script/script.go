@@ -0,0 +1,293 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	starjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+
+	"github.com/patterninc/caterpillar/internal/pkg/jq"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+)
+
+const (
+	processFunction = `process`
+	finishFunction  = `finish`
+	emitBuiltin     = `emit`
+	emittedKey      = `emitted`
+)
+
+var (
+	fileOptions = &syntax.FileOptions{
+		Set:             true,
+		While:           true,
+		TopLevelControl: true,
+	}
+	predeclared = builtins()
+)
+
+type script struct {
+	task.Base   `yaml:",inline" json:",inline"`
+	Script      string   `yaml:"script,omitempty" json:"script,omitempty" validate:"required_without=File,excluded_with=File"`
+	File        string   `yaml:"file,omitempty" json:"file,omitempty"`
+	MaxSteps    uint64   `yaml:"max_steps,omitempty" json:"max_steps,omitempty"`
+	SetsContext []string `yaml:"context_keys,omitempty" json:"context_keys,omitempty"` // keys the script sets, for validate
+
+	program *starlark.Program
+}
+
+// emitted is a record the script emitted while it handled a record
+type emitted struct {
+	data    []byte
+	context map[string]string
+}
+
+func New() (task.Task, error) {
+	return &script{}, nil
+}
+
+func (s *script) Init() error {
+
+	source, filename := s.Script, s.Name
+	if s.File != `` {
+		content, err := os.ReadFile(s.File)
+		if err != nil {
+			return err
+		}
+		source, filename = string(content), s.File
+	}
+
+	_, program, err := starlark.SourceProgramOptions(fileOptions, filename, source, predeclared.Has)
+	if err != nil {
+		return err
+	}
+	s.program = program
+
+	// the script is run once here, so a missing process function fails early
+	_, _, err = s.load()
+
+	return err
+
+}
+
+// ContextKeys returns the context keys the script declares it sets
+func (s *script) ContextKeys() []string {
+	return s.SetsContext
+}
+
+func (s *script) Run(_ context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
+
+	if input == nil {
+		return task.ErrNilInput
+	}
+
+	// every worker runs the script on its own, so its globals are the state of the worker
+	thread, globals, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	for {
+		r, ok := s.GetRecord(input)
+		if !ok {
+			break
+		}
+
+		records, err := s.call(thread, globals[processFunction], starlark.String(r.Data), contextDict(r.ContextValues()))
+		if err != nil {
+			if s.DeadLetter(r, err) {
+				continue
+			}
+			return err
+		}
+		s.send(r.Context, records, output)
+	}
+
+	if finish, found := globals[finishFunction]; found {
+		records, err := s.call(thread, finish)
+		if err != nil {
+			if s.DeadLetter(nil, err) {
+				return nil
+			}
+			return err
+		}
+		s.send(nil, records, output)
+	}
+
+	return nil
+
+}
+
+// load runs the script and returns its globals, with the thread to call its functions on
+func (s *script) load() (*starlark.Thread, starlark.StringDict, error) {
+
+	thread := &starlark.Thread{
+		Name: s.Name,
+		Print: func(_ *starlark.Thread, message string) {
+			s.Logger().Info(message)
+		},
+	}
+
+	globals, err := s.program.Init(thread, predeclared)
+	if err != nil {
+		return nil, nil, describe(err)
+	}
+
+	if _, ok := globals[processFunction].(starlark.Callable); !ok {
+		return nil, nil, fmt.Errorf("the script must define a function %s(data, context)", processFunction)
+	}
+	if finish, found := globals[finishFunction]; found {
+		if _, ok := finish.(starlark.Callable); !ok {
+			return nil, nil, fmt.Errorf("%s must be a function", finishFunction)
+		}
+	}
+
+	return thread, globals, nil
+
+}
+
+// call calls a function of the script and returns the records it emitted
+func (s *script) call(thread *starlark.Thread, fn starlark.Value, args ...starlark.Value) ([]*emitted, error) {
+
+	var records []*emitted
+	thread.SetLocal(emittedKey, &records)
+	// the limit is per call, and a call stopped by it does not stop the next
+	if s.MaxSteps > 0 {
+		thread.Uncancel()
+		thread.SetMaxExecutionSteps(thread.ExecutionSteps() + s.MaxSteps)
+	}
+
+	if _, err := starlark.Call(thread, fn, args, nil); err != nil {
+		return nil, describe(err)
+	}
+
+	return records, nil
+
+}
+
+// send sends the emitted records with the context of the record they come from,
+// and the context the script set on top of it
+func (s *script) send(recordContext record.Metadata, records []*emitted, output chan<- *record.Record) {
+
+	for _, e := range records {
+		rc := &record.Record{Context: recordContext}
+		for key, value := range e.context {
+			rc.SetContextValue(key, value)
+		}
+		s.SendData(rc.Context, e.data, output)
+	}
+
+}
+
+// describe adds the Starlark backtrace to an error of the script
+func describe(err error) error {
+
+	if evalErr, ok := err.(*starlark.EvalError); ok {
+		return fmt.Errorf("%s", evalErr.Backtrace())
+	}
+
+	return err
+
+}
+
+func contextDict(values map[string]string) *starlark.Dict {
+
+	dict := starlark.NewDict(len(values))
+	for key, value := range values {
+		dict.SetKey(starlark.String(key), starlark.String(value))
+	}
+
+	return dict
+
+}
+
+// builtins returns what scripts can use besides the Starlark built-ins: emit,
+// json, and the custom functions of jq on strings
+func builtins() starlark.StringDict {
+
+	values := starlark.StringDict{
+		`json`:      starjson.Module,
+		emitBuiltin: starlark.NewBuiltin(emitBuiltin, emit),
+	}
+
+	for name, helper := range jq.Helpers() {
+		values[name] = starlark.NewBuiltin(name, func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			if len(kwargs) > 0 {
+				return nil, fmt.Errorf("%s: unexpected keyword arguments", b.Name())
+			}
+			if len(args) < helper.MinArgs || len(args) > helper.MaxArgs {
+				return nil, fmt.Errorf("%s: got %d arguments, want %d to %d", b.Name(), len(args), helper.MinArgs, helper.MaxArgs)
+			}
+			strings := make([]string, len(args))
+			for i, arg := range args {
+				value, ok := starlark.AsString(arg)
+				if !ok {
+					return nil, fmt.Errorf("%s: argument %d must be a string, not %s", b.Name(), i+1, arg.Type())
+				}
+				strings[i] = value
+			}
+			result, err := helper.Call(strings)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", b.Name(), err)
+			}
+			return starlark.String(result), nil
+		})
+	}
+
+	return values
+
+}
+
+// emit(data, context=None) sends a record: strings and bytes as they are, other
+// values as JSON, with the context given set on it
+func emit(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+
+	var data starlark.Value
+	var recordContext *starlark.Dict
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, `data`, &data, `context?`, &recordContext); err != nil {
+		return nil, err
+	}
+
+	records, ok := thread.Local(emittedKey).(*[]*emitted)
+	if !ok {
+		return nil, fmt.Errorf("%s: records can only be emitted from %s or %s", b.Name(), processFunction, finishFunction)
+	}
+
+	e := &emitted{}
+	switch value := data.(type) {
+	case starlark.String:
+		e.data = []byte(value)
+	case starlark.Bytes:
+		e.data = []byte(value)
+	default:
+		encoded, err := starlark.Call(thread, starjson.Module.Members[`encode`], starlark.Tuple{data}, nil)
+		if err != nil {
+			return nil, err
+		}
+		e.data = []byte(encoded.(starlark.String))
+	}
+
+	if recordContext != nil {
+		e.context = make(map[string]string, recordContext.Len())
+		for _, item := range recordContext.Items() {
+			key, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, fmt.Errorf("%s: context keys must be strings, not %s", b.Name(), item[0].Type())
+			}
+			value, ok := starlark.AsString(item[1])
+			if !ok {
+				value = item[1].String()
+			}
+			e.context[key] = value
+		}
+	}
+
+	*records = append(*records, e)
+
+	return starlark.None, nil
+
+}
@@ -2,6 +2,7 @@ package sftp
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	pathpkg "path"
@@ -75,8 +76,9 @@ func (s *sftp) uploadOne(client *pkgsftp.Client, file string, data []byte) error
 
 // download (source): read file(s) at Path (a single file or a glob) and emit
 // one record per file. The base name is stored in the record context so a
-// downstream task can name what it writes (mirrors file.readFile).
-func (s *sftp) download(client *pkgsftp.Client, output chan<- *record.Record) error {
+// downstream task can name what it writes (mirrors file.readFile). Once ctx is
+// done it stops between files, so a shutdown never emits a partial download.
+func (s *sftp) download(ctx context.Context, client *pkgsftp.Client, output chan<- *record.Record) error {
 
 	path, err := s.Path.Get(nil)
 	if err != nil {
@@ -88,15 +90,33 @@ func (s *sftp) download(client *pkgsftp.Client, output chan<- *record.Record) er
 		return err
 	}
 
+	checkpoint := s.Checkpoint()
+
 	for _, p := range paths {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// skip files an earlier run already downloaded
+		if checkpoint != nil && checkpoint.Done(p) {
+			s.Logger().Debug(`skipping file completed by an earlier run`, `path`, p)
+			continue
+		}
+
 		data, err := s.downloadOne(client, p)
 		if err != nil {
 			return err
 		}
 
-		rc := &record.Record{Context: ctx}
+		rc := &record.Record{}
 		rc.SetContextValue(string(task.CtxKeyFileNameWrite), textutil.SlugifyFileName(pathpkg.Base(p)))
 		s.SendData(rc.Context, data, output)
+
+		if checkpoint != nil {
+			if err := checkpoint.Complete(p); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -3,6 +3,7 @@ package sftp
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net"
 	"strconv"
 	"time"
@@ -26,8 +27,6 @@ const (
 	defaultRetryDelay = duration.Duration(1 * time.Second)
 )
 
-var ctx = context.Background()
-
 type sftp struct {
 	task.Base `yaml:",inline" json:",inline"`
 
@@ -90,7 +89,17 @@ func (s *sftp) Init() error {
 
 // Run infers its role from the channels, like the file task: no input → source
 // (download); an input → sink (upload). Never both.
-func (s *sftp) Run(input <-chan *record.Record, output chan<- *record.Record) error {
+// Positions returns where the task can run: files are either downloaded or uploaded
+func (s *sftp) Positions() task.Position {
+	return task.PositionFirst | task.PositionLast
+}
+
+// ContextKeys returns the context keys set on the records of downloaded files
+func (s *sftp) ContextKeys() []string {
+	return []string{string(task.CtxKeyFileNameWrite)}
+}
+
+func (s *sftp) Run(ctx context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
 
 	if input != nil && output != nil {
 		return task.ErrPresentInputOutput
@@ -104,7 +113,7 @@ func (s *sftp) Run(input <-chan *record.Record, output chan<- *record.Record) er
 	defer sftpClient.Close()
 
 	if input == nil {
-		return s.download(sftpClient, output)
+		return s.download(ctx, sftpClient, output)
 	}
 
 	return s.upload(sftpClient, input)
@@ -217,7 +226,7 @@ func (s *sftp) buildHostKeyCallback() (ssh.HostKeyCallback, []string, error) {
 
 // withRetry runs fn up to attempts times, sleeping delay between tries and
 // logging a warning on each retried failure so flaky connections are visible.
-func withRetry(label string, attempts int, delay time.Duration, fn func() error) error {
+func withRetry(logger *slog.Logger, attempts int, delay time.Duration, fn func() error) error {
 
 	if attempts < 1 {
 		attempts = 1
@@ -229,7 +238,7 @@ func withRetry(label string, attempts int, delay time.Duration, fn func() error)
 			return nil
 		}
 		if i < attempts-1 {
-			fmt.Printf("WARN: %s: attempt %d/%d failed: %v; retrying in %s\n", label, i+1, attempts, err, delay)
+			logger.Warn(`attempt failed, retrying`, `attempt`, i+1, `attempts`, attempts, `delay`, delay, `error`, err)
 			time.Sleep(delay)
 		}
 	}
@@ -239,5 +248,5 @@ func withRetry(label string, attempts int, delay time.Duration, fn func() error)
 }
 
 func (s *sftp) retry(action string, fn func() error) error {
-	return withRetry(fmt.Sprintf(`sftp task %q: %s`, s.Name, action), s.MaxRetries, time.Duration(s.RetryDelay), fn)
+	return withRetry(s.Logger().With(`action`, action), s.MaxRetries, time.Duration(s.RetryDelay), fn)
 }
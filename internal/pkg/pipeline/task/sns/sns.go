@@ -13,6 +13,7 @@ import (
 
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/aws/attributes"
 )
 
 type MessageAttribute struct {
@@ -21,7 +22,10 @@ type MessageAttribute struct {
 	Value string `yaml:"value" json:"value"`
 }
 
-const defaultRegion = "us-west-2"
+const (
+	defaultRegion  = "us-west-2"
+	stringDataType = "String"
+)
 
 type snsTask struct {
 	task.Base  `yaml:",inline" json:",inline"`
@@ -30,6 +34,9 @@ type snsTask struct {
 	Subject    string             `yaml:"subject,omitempty" json:"subject,omitempty"`
 	Attributes []MessageAttribute `yaml:"attributes,omitempty" json:"attributes,omitempty"`
 
+	// PropagateContext publishes the record context as message attributes, besides those configured
+	PropagateContext bool `yaml:"propagate_context,omitempty" json:"propagate_context,omitempty"`
+
 	// FIFO specific fields
 	MessageGroupId         string `yaml:"message_group_id,omitempty" json:"message_group_id,omitempty"`
 	MessageDeduplicationId string `yaml:"message_deduplication_id,omitempty" json:"message_deduplication_id,omitempty"`
@@ -42,10 +49,23 @@ func New() (task.Task, error) {
 	return &snsTask{}, nil
 }
 
-func (s *snsTask) Init() error {
+// Check validates the configuration without contacting AWS
+func (s *snsTask) Check() error {
 	if s.TopicArn == "" {
 		return fmt.Errorf("topic_arn is required")
 	}
+	return nil
+}
+
+// Positions returns where the task can run: sns only publishes records
+func (s *snsTask) Positions() task.Position {
+	return task.PositionLast
+}
+
+func (s *snsTask) Init() error {
+	if err := s.Check(); err != nil {
+		return err
+	}
 
 	region := s.Region
 	if region == "" {
@@ -64,7 +84,7 @@ func (s *snsTask) Init() error {
 	return nil
 }
 
-func (s *snsTask) Run(input <-chan *record.Record, output chan<- *record.Record) error {
+func (s *snsTask) Run(_ context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
 	if input == nil {
 		return task.ErrNilInput
 	}
@@ -91,25 +111,60 @@ func (s *snsTask) Run(input <-chan *record.Record, output chan<- *record.Record)
 			s.setFifoParams(publishInput)
 		}
 
-		if len(s.Attributes) > 0 {
-			publishInput.MessageAttributes = make(map[string]types.MessageAttributeValue)
-			for _, attr := range s.Attributes {
-				publishInput.MessageAttributes[attr.Name] = types.MessageAttributeValue{
-					DataType:    aws.String(attr.Type),
-					StringValue: aws.String(attr.Value),
-				}
-			}
-		}
+		publishInput.MessageAttributes = s.messageAttributes(r)
 
-		_, err := s.client.Publish(r.Context, publishInput)
+		_, err := s.client.Publish(context.Background(), publishInput)
 		if err != nil {
-			return fmt.Errorf("failed to publish to SNS topic %s: %w", s.TopicArn, err)
+			err = fmt.Errorf("failed to publish to SNS topic %s: %w", s.TopicArn, err)
+			if s.DeadLetter(r, err) {
+				continue
+			}
+			return err
 		}
 	}
 
 	return nil
 }
 
+// messageAttributes returns the attributes configured and, with propagate_context,
+// the context of r; the attributes configured win over context keys of the same
+// name. SNS does not take empty values, so those are left out, and the context
+// keys it would reject, for their name or past its limit, are logged and dropped.
+func (s *snsTask) messageAttributes(r *record.Record) map[string]types.MessageAttributeValue {
+
+	if len(s.Attributes) == 0 && !s.PropagateContext {
+		return nil
+	}
+
+	messageAttributes := make(map[string]types.MessageAttributeValue)
+	for _, attr := range s.Attributes {
+		messageAttributes[attr.Name] = types.MessageAttributeValue{
+			DataType:    aws.String(attr.Type),
+			StringValue: aws.String(attr.Value),
+		}
+	}
+
+	if s.PropagateContext {
+		values := task.PropagatedContext(r)
+		for name := range messageAttributes {
+			delete(values, name)
+		}
+		names, dropped := attributes.Select(values, attributes.MaxCount-len(messageAttributes))
+		if len(dropped) > 0 {
+			s.RecordLogger(r).Warn(`dropping context keys SNS does not take as message attributes`, `keys`, dropped)
+		}
+		for _, name := range names {
+			messageAttributes[name] = types.MessageAttributeValue{
+				DataType:    aws.String(stringDataType),
+				StringValue: aws.String(values[name]),
+			}
+		}
+	}
+
+	return messageAttributes
+
+}
+
 func (s *snsTask) setFifoParams(publishInput *sns.PublishInput) {
 	groupID := s.MessageGroupId
 	if groupID == "" {
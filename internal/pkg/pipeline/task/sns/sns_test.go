@@ -0,0 +1,99 @@
+package sns
+
+import (
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+)
+
+// Test that the attributes configured and the context of a record go as message
+// attributes SNS takes
+func TestMessageAttributes(t *testing.T) {
+	tests := []struct {
+		name             string
+		attributes       []MessageAttribute
+		propagateContext bool
+		context          map[string]string
+		expected         map[string]types.MessageAttributeValue
+	}{
+		{
+			name:    "No attributes",
+			context: map[string]string{"user_id": "42"},
+		},
+		{
+			name:       "Attributes configured",
+			attributes: []MessageAttribute{{Name: "source", Type: "String", Value: "caterpillar"}},
+			context:    map[string]string{"user_id": "42"},
+			expected:   map[string]types.MessageAttributeValue{"source": attribute("String", "caterpillar")},
+		},
+		{
+			name:             "Context propagated",
+			propagateContext: true,
+			context:          map[string]string{"user_id": "42", "empty": "", string(task.CtxKeyPort): "users"},
+			expected:         map[string]types.MessageAttributeValue{"user_id": attribute(stringDataType, "42")},
+		},
+		{
+			name:             "Attributes configured win over context",
+			attributes:       []MessageAttribute{{Name: "user_id", Type: "Number", Value: "7"}},
+			propagateContext: true,
+			context:          map[string]string{"user_id": "42", "tenant": "acme"},
+			expected: map[string]types.MessageAttributeValue{
+				"user_id": attribute("Number", "7"),
+				"tenant":  attribute(stringDataType, "acme"),
+			},
+		},
+		{
+			name:             "Invalid names dropped",
+			propagateContext: true,
+			context:          map[string]string{"user_id": "42", "user id": "42", "amazon.user": "42", ".user": "42"},
+			expected:         map[string]types.MessageAttributeValue{"user_id": attribute(stringDataType, "42")},
+		},
+		{
+			name:             "Attributes configured count toward the limit",
+			attributes:       []MessageAttribute{{Name: "source", Type: "String", Value: "caterpillar"}},
+			propagateContext: true,
+			context:          keys(10),
+			expected: func() map[string]types.MessageAttributeValue {
+				expected := map[string]types.MessageAttributeValue{"source": attribute("String", "caterpillar")}
+				for key, value := range keys(9) {
+					expected[key] = attribute(stringDataType, value)
+				}
+				return expected
+			}(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &snsTask{Attributes: tt.attributes, PropagateContext: tt.propagateContext}
+			s.SetLogger(slog.New(slog.DiscardHandler))
+
+			r := &record.Record{}
+			for key, value := range tt.context {
+				r.SetContextValue(key, value)
+			}
+
+			assert.Equal(t, tt.expected, s.messageAttributes(r))
+		})
+	}
+}
+
+func attribute(dataType, value string) types.MessageAttributeValue {
+	return types.MessageAttributeValue{DataType: aws.String(dataType), StringValue: aws.String(value)}
+}
+
+// keys returns count context values, key00 to key<count-1>
+func keys(count int) map[string]string {
+	values := make(map[string]string, count)
+	for i := 0; i < count; i++ {
+		values[fmt.Sprintf("key%02d", i)] = "value"
+	}
+	return values
+}
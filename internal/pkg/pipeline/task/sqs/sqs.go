@@ -12,10 +12,12 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	qs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	"github.com/google/uuid"
 
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/aws/attributes"
 )
 
 const (
@@ -24,6 +26,9 @@ const (
 	defaultWaitTimeSeconds  = 10
 	receiptsQueueMultiplier = 1000
 	defaultRegion           = "us-west-2"
+	allMessageAttributes    = "All"
+	stringDataType          = "String"
+	messageIDContextKey     = "sqs-message-id"
 )
 
 var (
@@ -32,13 +37,14 @@ var (
 )
 
 type sqs struct {
-	task.ServerBase `yaml:",inline" json:",inline"`
-	QueueURL        string `yaml:"queue_url" json:"queue_url" validate:"required"`
-	Concurrency     int    `yaml:"concurrency,omitempty" json:"concurrency,omitempty"`
-	MaxMessages     int32  `yaml:"max_messages,omitempty" json:"max_messages,omitempty"`
-	WaitTimeSeconds int    `yaml:"wait_time_seconds,omitempty" json:"wait_time_seconds,omitempty"`
-	ExitOnEmpty     bool   `yaml:"exit_on_empty,omitempty" json:"exit_on_empty,omitempty"`
-	MessageGroupId  string `yaml:"message_group_id,omitempty" json:"message_group_id,omitempty"` // used for FIFO queues
+	task.ServerBase  `yaml:",inline" json:",inline"`
+	QueueURL         string `yaml:"queue_url" json:"queue_url" validate:"required"`
+	Concurrency      int    `yaml:"concurrency,omitempty" json:"concurrency,omitempty"`
+	MaxMessages      int32  `yaml:"max_messages,omitempty" json:"max_messages,omitempty"`
+	WaitTimeSeconds  int    `yaml:"wait_time_seconds,omitempty" json:"wait_time_seconds,omitempty"`
+	ExitOnEmpty      bool   `yaml:"exit_on_empty,omitempty" json:"exit_on_empty,omitempty"`
+	MessageGroupId   string `yaml:"message_group_id,omitempty" json:"message_group_id,omitempty"` // used for FIFO queues
+	PropagateContext bool   `yaml:"propagate_context,omitempty" json:"propagate_context,omitempty"`
 
 	client *qs.Client
 }
@@ -53,11 +59,19 @@ func New() (task.Task, error) {
 
 }
 
+// Check validates the configuration without contacting AWS
+func (s *sqs) Check() error {
+	if s.QueueURL == "" {
+		return fmt.Errorf("queue_url is required")
+	}
+	return nil
+}
+
 // Init initializes the SQS client before pipeline execution
 // This is called once during task unmarshaling, before any goroutines are spawned
 func (s *sqs) Init() error {
-	if s.QueueURL == "" {
-		return fmt.Errorf("queue_url is required")
+	if err := s.Check(); err != nil {
+		return err
 	}
 
 	region := s.extractRegionFromQueueURL()
@@ -70,6 +84,15 @@ func (s *sqs) Init() error {
 	return nil
 }
 
+// ContextKeys returns the context keys set on the records read: with
+// propagate_context, any attribute of the messages
+func (s *sqs) ContextKeys() []string {
+	if !s.PropagateContext {
+		return nil
+	}
+	return []string{"*"}
+}
+
 func (s *sqs) extractRegionFromQueueURL() string {
 	// Split the URL by dots to extract the region
 	// https://sqs.us-west-2.amazonaws.com/84212345678/test-sqs
@@ -86,7 +109,7 @@ func (s *sqs) extractRegionFromQueueURL() string {
 	return defaultRegion
 }
 
-func (s *sqs) Run(input <-chan *record.Record, output chan<- *record.Record) error {
+func (s *sqs) Run(ctx context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
 
 	// Client is already initialized in RunPreHook - just use it
 	if input != nil {
@@ -116,7 +139,7 @@ func (s *sqs) getMessages(ctx context.Context, output chan<- *record.Record, rec
 
 	defer close(receipts)
 
-	// do we need to stop pipeline after a while?
+	// we stop on pipeline shutdown, or after a while if end_after is set
 	if s.EndAfter > 0 {
 		var cancel context.CancelFunc
 		ctx, cancel = context.WithTimeout(ctx, time.Duration(s.EndAfter))
@@ -126,30 +149,33 @@ func (s *sqs) getMessages(ctx context.Context, output chan<- *record.Record, rec
 	for {
 		select {
 		case <-ctx.Done():
-			// the time has come to stop the pipeline...
+			// the time has come to stop the pipeline (end_after or shutdown)...
 			return nil
 
 		default:
-			receiveMessageOutput, err := s.client.ReceiveMessage(ctx, &qs.ReceiveMessageInput{
+			receiveMessageInput := &qs.ReceiveMessageInput{
 				QueueUrl:            &s.QueueURL,
 				MaxNumberOfMessages: s.MaxMessages,
 				WaitTimeSeconds:     int32(s.WaitTimeSeconds),
-			})
+			}
+			if s.PropagateContext {
+				receiveMessageInput.MessageAttributeNames = []string{allMessageAttributes}
+			}
+			receiveMessageOutput, err := s.client.ReceiveMessage(ctx, receiveMessageInput)
 
 			if err != nil {
 				// not a real error, just normal shutdown
 				if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-					fmt.Println(`SQS message retrieval cancelled: `, err)
+					s.Logger().Info(`sqs message retrieval cancelled`, `reason`, err)
 					return nil
 				}
 				// otherwise, this is a real error
-				fmt.Println(`ReceiveMessage:`, err)
-				return err
+				return fmt.Errorf("receive message: %w", err)
 			}
 
 			if receiveMessageOutput == nil || len(receiveMessageOutput.Messages) == 0 {
 				if s.ExitOnEmpty {
-					fmt.Println(`Queue is empty, exiting`)
+					s.Logger().Info(`queue is empty, exiting`)
 					return nil
 				}
 				continue
@@ -159,7 +185,7 @@ func (s *sqs) getMessages(ctx context.Context, output chan<- *record.Record, rec
 				// create new record and send it downstream
 
 				if output != nil {
-					s.SendData(ctx, []byte(*m.Body), output)
+					s.SendData(s.messageContext(m), []byte(*m.Body), output)
 				}
 
 				// send receipt to receipts channel for deletion
@@ -198,11 +224,15 @@ func (s *sqs) sendMessages(input <-chan *record.Record) error {
 			break
 		}
 		_, err := s.client.SendMessage(ctx, &qs.SendMessageInput{
-			QueueUrl:       &s.QueueURL,
-			MessageBody:    aws.String(string(r.Data)),
-			MessageGroupId: s.getMessageGroupID(),
+			QueueUrl:          &s.QueueURL,
+			MessageBody:       aws.String(string(r.Data)),
+			MessageGroupId:    s.getMessageGroupID(),
+			MessageAttributes: s.messageAttributes(r),
 		})
 		if err != nil {
+			if s.DeadLetter(r, err) {
+				continue
+			}
 			return err
 		}
 	}
@@ -222,3 +252,52 @@ func (s *sqs) getMessageGroupID() *string {
 	}
 	return nil
 }
+
+// messageAttributes returns the context of r as message attributes, with
+// propagate_context; SQS does not take empty values, so those are left out, and
+// the keys it would reject, for their name or past its limit, are logged and dropped
+func (s *sqs) messageAttributes(r *record.Record) map[string]types.MessageAttributeValue {
+
+	if !s.PropagateContext {
+		return nil
+	}
+
+	values := task.PropagatedContext(r)
+	names, dropped := attributes.Select(values, attributes.MaxCount)
+	if len(dropped) > 0 {
+		s.RecordLogger(r).Warn(`dropping context keys SQS does not take as message attributes`, `keys`, dropped)
+	}
+
+	messageAttributes := make(map[string]types.MessageAttributeValue, len(names))
+	for _, name := range names {
+		messageAttributes[name] = types.MessageAttributeValue{
+			DataType:    aws.String(stringDataType),
+			StringValue: aws.String(values[name]),
+		}
+	}
+
+	return messageAttributes
+
+}
+
+// messageContext returns the string attributes of m as record context, with
+// its message id, with propagate_context
+func (s *sqs) messageContext(m types.Message) record.Metadata {
+
+	if !s.PropagateContext {
+		return nil
+	}
+
+	values := make(record.Metadata, len(m.MessageAttributes)+1)
+	for name, attribute := range m.MessageAttributes {
+		if attribute.StringValue != nil {
+			values[name] = *attribute.StringValue
+		}
+	}
+	if m.MessageId != nil {
+		values[messageIDContextKey] = *m.MessageId
+	}
+
+	return values
+
+}
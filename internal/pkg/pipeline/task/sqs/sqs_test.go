@@ -0,0 +1,127 @@
+package sqs
+
+import (
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+)
+
+// Test that the context of a record goes as message attributes SQS takes
+func TestMessageAttributes(t *testing.T) {
+	tests := []struct {
+		name             string
+		propagateContext bool
+		context          map[string]string
+		expected         map[string]string
+	}{
+		{
+			name:    "Context not propagated",
+			context: map[string]string{"user_id": "42"},
+		},
+		{
+			name:             "Context propagated",
+			propagateContext: true,
+			context: map[string]string{
+				"user_id":                      "42",
+				"empty":                        "",
+				string(task.CtxKeyRoute):       "users",
+				string(task.CtxKeyTraceParent): "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+			expected: map[string]string{
+				"user_id":                      "42",
+				string(task.CtxKeyTraceParent): "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+		},
+		{
+			name:             "Invalid names dropped",
+			propagateContext: true,
+			context:          map[string]string{"user_id": "42", "user id": "42", "AWS.user": "42", "user..id": "42"},
+			expected:         map[string]string{"user_id": "42"},
+		},
+		{
+			name:             "Keys over the limit dropped",
+			propagateContext: true,
+			context:          keys(12),
+			expected:         keys(10),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &sqs{PropagateContext: tt.propagateContext}
+			s.SetLogger(slog.New(slog.DiscardHandler))
+
+			r := &record.Record{}
+			for key, value := range tt.context {
+				r.SetContextValue(key, value)
+			}
+
+			var expected map[string]types.MessageAttributeValue
+			if tt.propagateContext {
+				expected = make(map[string]types.MessageAttributeValue)
+			}
+			for key, value := range tt.expected {
+				expected[key] = types.MessageAttributeValue{DataType: aws.String(stringDataType), StringValue: aws.String(value)}
+			}
+			assert.Equal(t, expected, s.messageAttributes(r))
+		})
+	}
+}
+
+// Test that the string attributes of a message come back as record context
+func TestMessageContext(t *testing.T) {
+	message := types.Message{
+		MessageId: aws.String("m-1"),
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"user_id": {DataType: aws.String(stringDataType), StringValue: aws.String("42")},
+			"payload": {DataType: aws.String("Binary"), BinaryValue: []byte("42")},
+		},
+	}
+
+	tests := []struct {
+		name             string
+		propagateContext bool
+		message          types.Message
+		expected         record.Metadata
+	}{
+		{
+			name:    "Context not propagated",
+			message: message,
+		},
+		{
+			name:             "Context propagated",
+			propagateContext: true,
+			message:          message,
+			expected:         record.Metadata{"user_id": "42", messageIDContextKey: "m-1"},
+		},
+		{
+			name:             "No attributes",
+			propagateContext: true,
+			message:          types.Message{},
+			expected:         record.Metadata{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &sqs{PropagateContext: tt.propagateContext}
+			assert.Equal(t, tt.expected, s.messageContext(tt.message))
+		})
+	}
+}
+
+// keys returns count context values, key00 to key<count-1>
+func keys(count int) map[string]string {
+	values := make(map[string]string, count)
+	for i := 0; i < count; i++ {
+		values[fmt.Sprintf("key%02d", i)] = "value"
+	}
+	return values
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"sync"
 
 	"github.com/patterninc/caterpillar/internal/pkg/jq"
@@ -14,6 +15,12 @@ const (
 	ErrUnsupportedFieldValue = `invalid value for field %s: %s`
 )
 
+// on_error values
+const (
+	OnErrorStop       = `stop`
+	OnErrorDeadLetter = `dead_letter`
+)
+
 var (
 	ErrNilInput           = fmt.Errorf(`input channel must not be nil`)
 	ErrPresentInput       = fmt.Errorf(`input channel must be nil`)
@@ -27,14 +34,144 @@ const (
 	CtxKeyFileNameWrite        contextKeyFile = "CATERPILLAR_FILE_NAME_WRITE"
 	CtxKeyFilePathWrite        contextKeyFile = "CATERPILLAR_FILE_PATH_WRITE"
 	CtxKeyArchiveFileNameWrite contextKeyFile = "CATERPILLAR_ARCHIVE_FILE_NAME_WRITE"
+	CtxKeyDeadLetterError      contextKeyFile = "CATERPILLAR_DEAD_LETTER_ERROR"
+	CtxKeyDeadLetterTask       contextKeyFile = "CATERPILLAR_DEAD_LETTER_TASK"
+	CtxKeyRoute                contextKeyFile = "CATERPILLAR_ROUTE"
+	CtxKeyPort                 contextKeyFile = "CATERPILLAR_PORT"
+	CtxKeyCheckpoint           contextKeyFile = "CATERPILLAR_CHECKPOINT" // the source unit a record comes from, to checkpoint it once handled
+	CtxKeySideInput            contextKeyFile = "CATERPILLAR_SIDE_INPUT" // the side input a record ends its branch on, set by the pipeline
+	CtxKeyTraceParent          contextKeyFile = "traceparent"            // W3C trace context, as sent in the header of the same name
 )
 
+// localContextKeys steer records inside the pipeline that sets them, so they are
+// not propagated to the next one
+var localContextKeys = []contextKeyFile{
+	CtxKeyFileNameWrite,
+	CtxKeyFilePathWrite,
+	CtxKeyArchiveFileNameWrite,
+	CtxKeyRoute,
+	CtxKeyPort,
+	CtxKeyCheckpoint,
+	CtxKeySideInput,
+}
+
+// PropagatedContext returns the context values of r that tasks configured with
+// propagate_context write along with its data, for the tasks reading it back in
+// another pipeline to restore
+func PropagatedContext(r *record.Record) map[string]string {
+
+	values := r.ContextValues()
+	for _, key := range localContextKeys {
+		delete(values, string(key))
+	}
+
+	return values
+
+}
+
+// Task is a pipeline stage. Run is called once per worker; the context it
+// receives is cancelled when the pipeline is asked to stop (e.g. on SIGINT or
+// SIGTERM). A task without input is a source and should stop producing and
+// return nil once the context is done; a task with input should keep draining
+// it until it is closed, so records already in flight still reach the sinks.
 type Task interface {
-	Run(<-chan *record.Record, chan<- *record.Record) error
+	Run(context.Context, <-chan *record.Record, chan<- *record.Record) error
 	GetName() string
+	GetType() string
 	GetFailOnError() bool
 	GetTaskConcurrency() int
-	Init() error // Called once after unmarshaling, before pipeline execution
+	GetPreserveOrder() bool
+	GetOnError() string
+	SetDeadLetter(chan<- *record.Record) // Called by the pipeline before Run when on_error is dead_letter
+	SetObserver(Observer)                // Called by the pipeline before Run when metrics are enabled or order is preserved
+	SetLogger(*slog.Logger)              // Called by the pipeline before Run
+	SetCheckpoint(Checkpoint)            // Called by the pipeline before Run when checkpointing is enabled
+	Init() error                         // Called once after unmarshaling, before pipeline execution
+}
+
+// Checkpoint remembers the source units (files, pages) a task finished, so that a
+// resumed run can skip the ones an earlier run completed
+type Checkpoint interface {
+	Done(unit string) bool
+	Complete(unit string) error
+	Advance(unit string) error // completes unit in place of the units before it
+	Last() (string, bool)
+}
+
+// Router is implemented by tasks that pick the downstream branch of each record.
+// They set CtxKeyRoute to the name of the task heading the branch, and the
+// pipeline sends the record to that branch only.
+type Router interface {
+	Targets() []string // names of the tasks records can be routed to
+}
+
+// SideInputReader is implemented by tasks that read the records of upstream tasks
+// apart from the rest of their input. Each side input must end a branch of the
+// group before the task; the pipeline sets CtxKeySideInput to its name on the
+// records leaving that branch, whichever task they were made by.
+type SideInputReader interface {
+	SideInputs() []string
+}
+
+// Ported is implemented by tasks that send records on named output ports, which
+// the dag can wire separately as task.port. A task sets the port of a record in
+// CtxKeyPort before sending it; an empty list means the task has no ports.
+type Ported interface {
+	Ports() []string
+}
+
+// Checker is implemented by tasks whose Init contacts external services. Check
+// runs the configuration checks of Init without them, so a pipeline can be
+// validated offline.
+type Checker interface {
+	Check() error
+}
+
+// Position is where a task sits in a pipeline: a first task has no input and a
+// last task has no output
+type Position int
+
+const (
+	PositionFirst Position = 1 << iota
+	PositionMiddle
+	PositionLast
+)
+
+// Placed is implemented by tasks that only run at some positions, e.g. sources
+// that cannot take input; Positions returns those positions combined.
+type Placed interface {
+	Positions() Position
+}
+
+// ContextSetter is implemented by tasks that set context keys of their own on
+// the records they send, besides those in their context field. A key ending in
+// * stands for every key with that prefix.
+type ContextSetter interface {
+	ContextKeys() []string
+}
+
+// Feeder is implemented by sources that Go callers can hand records to before
+// the pipeline runs; they are sent after the records of the configuration.
+type Feeder interface {
+	Feed(records ...*record.Record)
+}
+
+// Collector is implemented by sinks that keep the records they read in memory,
+// for Go callers to read once the pipeline has run
+type Collector interface {
+	Records() []*record.Record
+}
+
+// Observer is told about every record a task reads and sends. Waiting is called
+// when a worker asks for its next record, before it blocks on input; Received once
+// the record is read, or with a nil record once input is closed. input identifies
+// the worker reading it. Failed is called with the record that failed, nil when
+// the error is not tied to one.
+type Observer interface {
+	Waiting(input <-chan *record.Record)
+	Received(input <-chan *record.Record, r *record.Record)
+	Sent(r *record.Record)
+	Failed(r *record.Record, err error)
 }
 
 type Base struct {
@@ -42,12 +179,27 @@ type Base struct {
 	Type            string               `yaml:"type,omitempty" json:"type,omitempty"`
 	FailOnError     bool                 `yaml:"fail_on_error,omitempty" json:"fail_on_error,omitempty"`
 	TaskConcurrency int                  `yaml:"task_concurrency,omitempty" json:"task_concurrency,omitempty"`
+	PreserveOrder   bool                 `yaml:"preserve_order,omitempty" json:"preserve_order,omitempty"`
 	Context         map[string]*jq.Query `yaml:"context,omitempty" json:"context,omitempty"`
+	OnError         string               `yaml:"on_error,omitempty" json:"on_error,omitempty" validate:"omitempty,oneof=stop dead_letter"`
 
 	recordIndex int
+	deadLetter  chan<- *record.Record
+	observer    Observer
+	logger      *slog.Logger
+	checkpoint  Checkpoint
 	sync.RWMutex
 }
 
+// deadLetterRecord is the payload sent to the dead-letter branch in place of a failed record
+type deadLetterRecord struct {
+	Error  string `json:"error"`
+	Task   string `json:"task"`
+	ID     int    `json:"id,omitempty"`
+	Origin string `json:"origin,omitempty"`
+	Data   string `json:"data,omitempty"`
+}
+
 func (b *Base) GetFailOnError() bool {
 	return b.FailOnError
 }
@@ -56,13 +208,115 @@ func (b *Base) GetName() string {
 	return b.Name
 }
 
+func (b *Base) GetType() string {
+	return b.Type
+}
+
 func (b *Base) GetTaskConcurrency() int {
 	if b.TaskConcurrency < 0 {
-		fmt.Printf(`WARN: defaulting task_concurrency to 1 for task %s`, b.Name)
+		b.Logger().Warn(`defaulting task_concurrency to 1`)
 	}
 	return max(1, b.TaskConcurrency)
 }
 
+func (b *Base) GetPreserveOrder() bool {
+	return b.PreserveOrder
+}
+
+func (b *Base) GetOnError() string {
+	if b.OnError == `` {
+		return OnErrorStop
+	}
+	return b.OnError
+}
+
+func (b *Base) SetDeadLetter(deadLetter chan<- *record.Record) {
+	b.deadLetter = deadLetter
+}
+
+func (b *Base) SetObserver(observer Observer) {
+	b.observer = observer
+}
+
+func (b *Base) SetLogger(logger *slog.Logger) {
+	b.logger = logger.With(`task`, b.Name)
+}
+
+func (b *Base) SetCheckpoint(checkpoint Checkpoint) {
+	b.checkpoint = checkpoint
+}
+
+// Checkpoint returns the task's checkpoint, or nil when checkpointing is disabled
+func (b *Base) Checkpoint() Checkpoint {
+	return b.checkpoint
+}
+
+// Logger returns the task's logger, with the task name attached
+func (b *Base) Logger() *slog.Logger {
+	if b.logger == nil {
+		return slog.Default().With(`task`, b.Name)
+	}
+	return b.logger
+}
+
+// RecordLogger returns the task's logger with the record's ID and origin attached
+func (b *Base) RecordLogger(r *record.Record) *slog.Logger {
+	if r == nil {
+		return b.Logger()
+	}
+	return b.Logger().With(`record_id`, r.ID, `origin`, r.Origin)
+}
+
+// DeadLetter sends the failed record r, wrapped with err and the task name, to the
+// pipeline's dead-letter branch and reports whether it did. It only does so when the
+// task is configured with on_error: dead_letter; otherwise the caller should return
+// err as before. r may be nil when the failure is not tied to an input record.
+func (b *Base) DeadLetter(r *record.Record, err error) bool {
+
+	if b.GetOnError() != OnErrorDeadLetter || b.deadLetter == nil {
+		return false
+	}
+
+	payload := deadLetterRecord{
+		Error: err.Error(),
+		Task:  b.Name,
+	}
+
+	// keep the original context so placeholders still resolve downstream
+	var recordContext record.Metadata
+	if r != nil {
+		payload.ID, payload.Origin, payload.Data = r.ID, r.Origin, string(r.Data)
+		recordContext = r.Context
+	}
+
+	data, marshalErr := json.Marshal(payload)
+	if marshalErr != nil {
+		return false
+	}
+
+	dl := &record.Record{
+		ID:      payload.ID,
+		Origin:  b.Name,
+		Data:    data,
+		Context: recordContext,
+	}
+	dl.SetContextValue(string(CtxKeyDeadLetterError), payload.Error)
+	dl.SetContextValue(string(CtxKeyDeadLetterTask), payload.Task)
+	// the failed record is handled by this task, so its copy in the dead-letter branch is not tracked
+	if _, found := dl.GetContextValue(string(CtxKeyCheckpoint)); found {
+		dl.SetContextValue(string(CtxKeyCheckpoint), ``)
+	}
+
+	b.RecordLogger(r).Warn(`sending record to dead letter`, `error`, err)
+	if b.observer != nil {
+		b.observer.Failed(r, err)
+	}
+	b.deadLetter <- dl
+
+	return true
+
+}
+
 // Init is called once after unmarshaling, before pipeline execution
 // Default implementation does nothing. Tasks can override this for initialization.
 func (b *Base) Init() error {
@@ -75,14 +329,24 @@ func (b *Base) GetRecord(input <-chan *record.Record) (*record.Record, bool) {
 		return nil, false
 	}
 
+	if b.observer != nil {
+		b.observer.Waiting(input)
+	}
 	record, ok := <-input
+	if b.observer != nil {
+		b.observer.Received(input, record)
+	}
 	return record, ok
 
 }
 
-func (b *Base) Run(input <-chan *record.Record, output chan<- *record.Record) error {
+func (b *Base) Run(_ context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
 
-	for r := range input {
+	for {
+		r, ok := b.GetRecord(input)
+		if !ok {
+			break
+		}
 		b.SendRecord(r, output)
 	}
 
@@ -90,18 +354,20 @@ func (b *Base) Run(input <-chan *record.Record, output chan<- *record.Record) er
 
 }
 
-func (b *Base) SendData(ctx context.Context, data []byte, output chan<- *record.Record) /* we should return error here */ {
+// SendData sends data as a new record of the task, with the context given
+func (b *Base) SendData(recordContext record.Metadata, data []byte, output chan<- *record.Record) /* we should return error here */ {
 
+	// only the index is guarded, so a worker blocked on a full output does not hold up the others
 	b.Lock()
-	defer b.Unlock()
-
 	b.recordIndex++
+	id := b.recordIndex
+	b.Unlock()
 
 	record := &record.Record{
-		ID:      b.recordIndex,
+		ID:      id,
 		Origin:  b.Name,
 		Data:    data,
-		Context: ctx,
+		Context: recordContext,
 	}
 
 	b.SendRecord(record, output)
@@ -115,29 +381,33 @@ func (b *Base) SendRecord(r *record.Record, output chan<- *record.Record) /* we
 	}
 
 	defer func() {
+		if b.observer != nil {
+			b.observer.Sent(r)
+		}
 		output <- r
 	}()
 
+	if len(b.Context) == 0 {
+		return
+	}
+
 	// before we set context, let's serialize the whole record
 	data, err := json.Marshal(r)
 	if err != nil {
-		// TODO: do prom metrics / log event to syslog
-		fmt.Println(`ERROR (marshal):`, err)
+		b.RecordLogger(r).Error(`cannot marshal record`, `error`, err)
 		return
 	}
 	// Set the context values for the record
 	for name, query := range b.Context {
 		queryResult, err := query.Execute(data)
 		if err != nil {
-			// TODO: do prom metrics / log event to syslog
-			fmt.Println(`ERROR (query):`, err)
+			b.RecordLogger(r).Error(`cannot evaluate context`, `name`, name, `error`, err)
 			return
 		}
 		// now, let's marshal it to json and set in the context...
 		contextValueJson, err := json.Marshal(queryResult)
 		if err != nil {
-			// TODO: do prom metrics / log event to syslog
-			fmt.Println(`ERROR (result):`, err)
+			b.RecordLogger(r).Error(`cannot marshal context value`, `name`, name, `error`, err)
 			return
 		}
 		r.SetContextValue(name, string(contextValueJson))
@@ -0,0 +1,60 @@
+package values
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/memory"
+)
+
+type values struct {
+	task.Base `yaml:",inline" json:",inline"`
+	Values    []any `yaml:"values,omitempty" json:"values,omitempty" validate:"required"`
+}
+
+func New() (task.Task, error) {
+	return &values{}, nil
+}
+
+func (v *values) Init() error {
+
+	for i, value := range v.Values {
+		if _, err := memory.Data(value); err != nil {
+			return fmt.Errorf("value %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+
+}
+
+// Positions returns where the task can run: it is a source
+func (v *values) Positions() task.Position {
+	return task.PositionFirst
+}
+
+func (v *values) Run(ctx context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
+
+	if input != nil {
+		return task.ErrPresentInput
+	}
+	if output == nil {
+		return task.ErrNilOutput
+	}
+
+	for _, value := range v.Values {
+		if ctx.Err() != nil {
+			return nil
+		}
+		data, err := memory.Data(value)
+		if err != nil {
+			return err
+		}
+		v.SendData(nil, data, output)
+	}
+
+	return nil
+
+}
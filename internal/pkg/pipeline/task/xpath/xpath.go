@@ -2,6 +2,7 @@ package xpath
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -27,7 +28,12 @@ func New() (task.Task, error) {
 	return &xpath{IgnoreMissing: true}, nil
 }
 
-func (x *xpath) Run(input <-chan *record.Record, output chan<- *record.Record) error {
+// ContextKeys returns the context keys set on the records sent
+func (x *xpath) ContextKeys() []string {
+	return []string{nodeIndexKey}
+}
+
+func (x *xpath) Run(_ context.Context, input <-chan *record.Record, output chan<- *record.Record) error {
 
 	for {
 		r, ok := x.GetRecord(input)
@@ -37,6 +43,9 @@ func (x *xpath) Run(input <-chan *record.Record, output chan<- *record.Record) e
 
 		document, err := htmlquery.Parse(bytes.NewReader(r.Data))
 		if err != nil {
+			if x.DeadLetter(r, err) {
+				continue
+			}
 			return err
 		}
 
@@ -45,9 +54,13 @@ func (x *xpath) Run(input <-chan *record.Record, output chan<- *record.Record) e
 			containerNodes = htmlquery.Find(document, x.Container)
 			if len(containerNodes) == 0 {
 				if !x.IgnoreMissing {
-					return fmt.Errorf("no nodes found for XPath: %s", x.Container)
+					err := fmt.Errorf("no nodes found for XPath: %s", x.Container)
+					if x.DeadLetter(r, err) {
+						continue
+					}
+					return err
 				}
-				fmt.Println("container is missing - ", x.Container)
+				x.RecordLogger(r).Warn(`container is missing`, `container`, x.Container)
 				continue
 			}
 		}
@@ -55,6 +68,9 @@ func (x *xpath) Run(input <-chan *record.Record, output chan<- *record.Record) e
 		for i, container := range containerNodes {
 			data, err := x.queryFields(container)
 			if err != nil {
+				if x.DeadLetter(r, err) {
+					break
+				}
 				return err
 			}
 
@@ -2,18 +2,25 @@ package pipeline
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/go-playground/validator/v10"
 	"gopkg.in/yaml.v3"
 
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/aggregate"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/archive"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/aws/parameter_store"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/collect"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/compress"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/converter"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/dedupe"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/delay"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/echo"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/enrich"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/exec"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/file"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/filter"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/flatten"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/heimdall"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/http"
@@ -21,12 +28,16 @@ import (
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/join"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/jq"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/kafka"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/memory"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/replace"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/route"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/sample"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/script"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/sftp"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/sns"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/split"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/sqs"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/values"
 	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/xpath"
 )
 
@@ -35,13 +46,19 @@ type tasks []task.Task
 var (
 	validate       = validator.New()
 	supportedTasks = map[string]func() (task.Task, error){
+		`aggregate`:           aggregate.New,
 		`archive`:             archive.New,
 		`aws_parameter_store`: parameter_store.New,
+		`collect`:             collect.New,
 		`compress`:            compress.New,
 		`converter`:           converter.New,
+		`dedupe`:              dedupe.New,
 		`delay`:               delay.New,
 		`echo`:                echo.New,
+		`enrich`:              enrich.New,
+		`exec`:                exec.New,
 		`file`:                file.New,
+		`filter`:              filter.New,
 		`flatten`:             flatten.New,
 		`heimdall`:            heimdall.New,
 		`http_server`:         server.New,
@@ -49,16 +66,53 @@ var (
 		`join`:                join.New,
 		`jq`:                  jq.New,
 		`kafka`:               kafka.New,
+		`memory`:              memory.New,
 		`replace`:             replace.New,
+		`route`:               route.New,
 		`sample`:              sample.New,
+		`script`:              script.New,
 		`sftp`:                sftp.New,
 		`sns`:                 sns.New,
 		`split`:               split.New,
 		`sqs`:                 sqs.New,
+		`values`:              values.New,
 		`xpath`:               xpath.New,
 	}
+	supportedTasksLock sync.RWMutex
 )
 
+// RegisterTask adds a task type that configurations can use, e.g. one defined by
+// a service embedding caterpillar. Types already supported cannot be replaced.
+func RegisterTask(taskType string, newTask func() (task.Task, error)) error {
+
+	if taskType == `` || newTask == nil {
+		return fmt.Errorf("a task type needs a name and a constructor")
+	}
+
+	supportedTasksLock.Lock()
+	defer supportedTasksLock.Unlock()
+
+	if _, found := supportedTasks[taskType]; found {
+		return fmt.Errorf("task type is already supported: %s", taskType)
+	}
+	supportedTasks[taskType] = newTask
+
+	return nil
+
+}
+
+// taskConstructor returns the constructor of a supported task type
+func taskConstructor(taskType string) (func() (task.Task, error), bool) {
+
+	supportedTasksLock.RLock()
+	defer supportedTasksLock.RUnlock()
+
+	newTask, found := supportedTasks[taskType]
+
+	return newTask, found
+
+}
+
 func (t *tasks) UnmarshalYAML(unmarshal func(any) error) error {
 
 	nodes := make([]yaml.Node, 0, 10)
@@ -67,43 +121,56 @@ func (t *tasks) UnmarshalYAML(unmarshal func(any) error) error {
 		return err
 	}
 
+	result, err := decodeTasks(nodes, taskConstructor)
+	if err != nil {
+		return err
+	}
+
+	*t = result
+
+	return nil
+
+}
+
+// decodeTasks decodes, validates and initializes tasks, finding the constructor
+// of their types with newTask
+func decodeTasks(nodes []yaml.Node, newTask func(string) (func() (task.Task, error), bool)) (tasks, error) {
+
 	result := make([]task.Task, 0, len(nodes))
 
 	for _, n := range nodes {
 		b := &task.Base{}
 		if err := n.Decode(b); err != nil {
-			return err
+			return nil, err
 		}
 
-		newFn, found := supportedTasks[b.Type]
+		newFn, found := newTask(b.Type)
 		if !found {
-			return fmt.Errorf("task type is not supported: %s", b.Type)
+			return nil, fmt.Errorf("task type is not supported: %s", b.Type)
 		}
 
 		t, err := newFn()
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		if err := n.Decode(t); err != nil {
-			return err
+			return nil, err
 		}
 
 		// Validate the task after decoding
 		if err := validate.Struct(t); err != nil {
-			return err
+			return nil, err
 		}
 
 		// Initialize task (e.g., create clients)
 		if err := t.Init(); err != nil {
-			return fmt.Errorf("failed to initialize task %s: %w", t.GetName(), err)
+			return nil, fmt.Errorf("failed to initialize task %s: %w", t.GetName(), err)
 		}
 
 		result = append(result, t)
 	}
 
-	*t = result
-
-	return nil
+	return result, nil
 
 }
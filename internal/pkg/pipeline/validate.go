@@ -0,0 +1,788 @@
+package pipeline
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"gopkg.in/yaml.v3"
+
+	"github.com/patterninc/caterpillar/internal/pkg/config"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+)
+
+var (
+	yamlErrorLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	// reports fields by their yaml names, so they can be found in the config
+	validateConfig = newConfigValidator()
+)
+
+// Problem is a mistake found in a pipeline configuration; Line is 0 when the
+// problem is not tied to a line
+type Problem struct {
+	Line    int
+	Message string
+}
+
+// validation collects the problems of a configuration as it is checked
+type validation struct {
+	problems []Problem
+	pipeline *Pipeline
+	sections map[string]*yaml.Node // top-level values by key
+	entries  []*entry              // tasks in the order they are defined
+	byName   map[string]*entry
+}
+
+// entry is a task definition; task is nil when it could not be decoded
+type entry struct {
+	node *yaml.Node
+	name string
+	kind string
+	task task.Task
+}
+
+// Validate checks a rendered pipeline configuration without running it: task
+// types and fields, dag references, where sources and sinks sit, and the context
+// keys tasks read. Tasks are not initialized when that would contact external
+// services. The problems found are returned ordered by line.
+func Validate(content []byte) []Problem {
+
+	v := newValidation()
+	if v.decode(content) {
+		v.validate()
+	}
+
+	return v.sorted()
+
+}
+
+// Decode decodes a rendered pipeline configuration the way Validate does, with
+// the problems that kept tasks or fields from being decoded. The pipeline can
+// be inspected but not run, since its tasks are not initialized.
+func Decode(content []byte) (*Pipeline, []Problem) {
+
+	v := newValidation()
+	v.decode(content)
+
+	return v.pipeline, v.sorted()
+
+}
+
+func newValidation() *validation {
+	return &validation{
+		pipeline: &Pipeline{},
+		sections: make(map[string]*yaml.Node),
+		byName:   make(map[string]*entry),
+	}
+}
+
+// decode decodes the configuration into the pipeline; it reports whether there
+// was a configuration to decode
+func (v *validation) decode(content []byte) bool {
+
+	document := &yaml.Node{}
+	if err := yaml.Unmarshal(content, document); err != nil {
+		v.addError(0, ``, err)
+		return false
+	}
+	if len(document.Content) == 0 {
+		return false
+	}
+
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		v.add(root.Line, "the configuration must be a mapping")
+		return false
+	}
+
+	v.validateSections(root)
+	v.validateTasks(v.sections[`tasks`])
+	v.pipeline.tasksToMap()
+
+	return true
+
+}
+
+func (v *validation) validate() {
+
+	p := v.pipeline
+
+	// the checks of Init only hold once every task is known
+	if v.validateReferences() && len(p.Tasks) == len(v.entries) {
+		for _, check := range []func() error{p.validateDeadLetter, p.validateRoutes, p.validatePorts, p.validateSideInputs} {
+			if err := check(); err != nil {
+				v.add(v.line(`dag`, `dead_letter`), "%v", err)
+			}
+		}
+	}
+
+	upstream, inputs, outputs := v.links()
+	v.validatePositions(upstream, inputs, outputs)
+	v.validateContextKeys(upstream)
+
+}
+
+// validateSections decodes every top-level field but tasks
+func (v *validation) validateSections(root *yaml.Node) {
+
+	p := v.pipeline
+	fields := yamlFields(reflect.TypeOf(p).Elem())
+	value := reflect.ValueOf(p).Elem()
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, node := root.Content[i], root.Content[i+1]
+		v.sections[key.Value] = node
+
+		if key.Value == `tasks` {
+			continue
+		}
+		field, found := fields[key.Value]
+		if !found {
+			v.add(key.Line, "unknown field %s", key.Value)
+			continue
+		}
+		if err := node.Decode(value.FieldByIndex(field.Index).Addr().Interface()); err != nil {
+			v.addError(node.Line, key.Value+`: `, err)
+		}
+	}
+
+	if _, err := newLogger(p.LogLevel, p.LogFormat); err != nil {
+		v.add(v.line(`log_level`, `log_format`), "%v", err)
+	}
+
+	if p.Metrics != nil {
+		if err := p.Metrics.Init(); err != nil {
+			v.add(v.line(`metrics`), "metrics: %v", err)
+		}
+	}
+
+	if p.Checkpoint != nil {
+		if err := p.Checkpoint.Init(); err != nil {
+			v.add(v.line(`checkpoint`), "%v", err)
+		}
+	}
+
+	if p.Tracing != nil {
+		if err := p.Tracing.Check(); err != nil {
+			v.add(v.line(`tracing`), "%v", err)
+		}
+	}
+
+	if err := p.validatePlugins(); err != nil {
+		v.add(v.line(`plugins`), "%v", err)
+	}
+
+}
+
+// validateTasks decodes and checks every task without initializing those that
+// contact external services
+func (v *validation) validateTasks(node *yaml.Node) {
+
+	if node == nil {
+		return
+	}
+	if node.Kind != yaml.SequenceNode {
+		v.add(node.Line, "tasks must be a list")
+		return
+	}
+
+	// tasks are only referred to by name in a dag
+	named := v.sections[`dag`] != nil || v.sections[`dead_letter`] != nil
+
+	for _, n := range node.Content {
+		if n.Kind != yaml.MappingNode {
+			v.add(n.Line, "a task must be a mapping")
+			continue
+		}
+
+		e := &entry{node: n}
+		if name := mappingValue(n, `name`); name != nil {
+			e.name = name.Value
+		}
+		if kind := mappingValue(n, `type`); kind != nil {
+			e.kind = kind.Value
+		}
+
+		v.entries = append(v.entries, e)
+		if other, found := v.byName[e.name]; found {
+			if named {
+				v.add(n.Line, "task name %s is already used on line %d", e.name, other.node.Line)
+			}
+		} else {
+			v.byName[e.name] = e
+		}
+		if named && e.name == `` {
+			v.add(n.Line, "task has no name, so the dag cannot refer to it")
+		}
+
+		if e.task = v.validateTask(e); e.task != nil {
+			v.pipeline.Tasks = append(v.pipeline.Tasks, e.task)
+		}
+	}
+
+}
+
+func (v *validation) validateTask(e *entry) task.Task {
+
+	n := e.node
+	prefix := fmt.Sprintf("task %s: ", e)
+
+	newFn, found := v.pipeline.taskConstructor(e.kind)
+	if !found {
+		v.add(valueLine(n, `type`), "%stask type is not supported: %s", prefix, e.kind)
+		return nil
+	}
+
+	t, err := newFn()
+	if err != nil {
+		v.add(n.Line, "%s%v", prefix, err)
+		return nil
+	}
+
+	// fields can only be listed for tasks that decode themselves from their struct
+	if fields := yamlFields(reflect.TypeOf(t)); fields != nil && !decodesItself(t) {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if key := n.Content[i]; fields[key.Value].Name == `` {
+				v.add(key.Line, "%sunknown field %s", prefix, key.Value)
+			}
+		}
+	}
+
+	if err := n.Decode(t); err != nil {
+		v.addError(n.Line, prefix, err)
+		return nil
+	}
+
+	if err := validateConfig.Struct(t); err != nil {
+		var fieldErrors validator.ValidationErrors
+		if !errors.As(err, &fieldErrors) {
+			v.add(n.Line, "%s%v", prefix, err)
+			return nil
+		}
+		for _, fieldError := range fieldErrors {
+			path := fieldPath(fieldError.Namespace())
+			v.add(pathLine(n, path), "%s%s %s", prefix, strings.Join(path, `.`), describeTag(fieldError))
+		}
+		return nil
+	}
+
+	check := t.Init
+	if checker, ok := t.(task.Checker); ok {
+		check = checker.Check
+	}
+	if err := check(); err != nil {
+		v.add(n.Line, "%s%v", prefix, err)
+		return nil
+	}
+
+	return t
+
+}
+
+// validateReferences checks that the dags only name defined tasks, and that a
+// dag leaves no task out; it reports whether every name was found
+func (v *validation) validateReferences() bool {
+
+	p := v.pipeline
+	complete := true
+
+	for i, dag := range []*DAG{p.DAG, p.DeadLetter} {
+		if dag == nil {
+			continue
+		}
+		section := []string{`dag`, `dead_letter`}[i]
+		for _, name := range sortedNames(dag.taskNames()) {
+			if _, found := v.byName[name]; !found {
+				v.add(v.line(section), "%s: task not found: %s", section, name)
+				complete = false
+			}
+		}
+	}
+
+	if p.DAG != nil {
+		for _, e := range v.entries {
+			if !v.runs(e) && e.name != `` {
+				v.add(e.node.Line, "task %s is not in the dag and never runs", e.name)
+			}
+		}
+	}
+
+	return complete
+
+}
+
+// links returns the tasks feeding each task that runs, and which tasks have an
+// input and an output
+func (v *validation) links() (map[*entry][]*entry, map[*entry]bool, map[*entry]bool) {
+
+	p := v.pipeline
+	upstream := make(map[*entry][]*entry)
+	inputs := make(map[*entry]bool)
+	outputs := make(map[*entry]bool)
+
+	// names the dag cannot resolve were already reported
+	link := func(from, to *entry) {
+		if from == nil || to == nil {
+			return
+		}
+		upstream[to] = append(upstream[to], from)
+		inputs[to] = true
+		outputs[from] = true
+	}
+
+	var deadLetterTasks map[string]bool
+	if p.DeadLetter != nil {
+		deadLetterTasks = p.DeadLetter.taskNames()
+	}
+
+	if p.DAG != nil {
+		edges, _ := p.DAG.edges(nil)
+		for _, e := range edges {
+			from, _ := splitPort(e.from)
+			link(v.byName[from], v.byName[e.to])
+		}
+	} else {
+		var previous *entry
+		for _, e := range v.entries {
+			if deadLetterTasks[e.name] {
+				continue
+			}
+			if previous != nil {
+				link(previous, e)
+			}
+			previous = e
+		}
+	}
+
+	if p.DeadLetter != nil {
+		// the heads of the branch read the records failed by tasks with on_error: dead_letter
+		edges, _ := p.DeadLetter.edges([]string{``})
+		for _, e := range edges {
+			from, _ := splitPort(e.from)
+			if from == `` {
+				if to := v.byName[e.to]; to != nil {
+					inputs[to] = true
+				}
+				continue
+			}
+			link(v.byName[from], v.byName[e.to])
+		}
+		for _, e := range v.entries {
+			if e.task != nil && e.task.GetOnError() == task.OnErrorDeadLetter {
+				for name := range p.DeadLetter.heads() {
+					if head := v.byName[name]; head != nil {
+						upstream[head] = append(upstream[head], e)
+					}
+				}
+			}
+		}
+	}
+
+	return upstream, inputs, outputs
+
+}
+
+// validatePositions checks that sources come first and sinks last
+func (v *validation) validatePositions(upstream map[*entry][]*entry, inputs, outputs map[*entry]bool) {
+
+	for _, e := range v.entries {
+		placed, ok := e.task.(task.Placed)
+		if !ok || !v.runs(e) {
+			continue
+		}
+
+		position := task.PositionMiddle
+		if !inputs[e] || !outputs[e] {
+			position = 0
+			if !inputs[e] {
+				position |= task.PositionFirst
+			}
+			if !outputs[e] {
+				position |= task.PositionLast
+			}
+		}
+
+		allowed := placed.Positions()
+		for _, p := range []task.Position{task.PositionFirst, task.PositionMiddle, task.PositionLast} {
+			if position&p != 0 && allowed&p == 0 {
+				v.add(e.node.Line, "task %s (%s) cannot be %s; it can only be %s", e, e.kind, describePosition(p), describePosition(allowed))
+			}
+		}
+	}
+
+}
+
+// validateContextKeys checks that every {{ context }} key a task reads is set
+// by a task upstream of it
+func (v *validation) validateContextKeys(upstream map[*entry][]*entry) {
+
+	p := v.pipeline
+	var deadLetterTasks map[string]bool
+	if p.DeadLetter != nil {
+		deadLetterTasks = p.DeadLetter.taskNames()
+	}
+
+	for _, e := range v.entries {
+		if !v.runs(e) {
+			continue
+		}
+
+		var keys []string
+		if deadLetterTasks[e.name] {
+			keys = append(keys, string(task.CtxKeyDeadLetterError), string(task.CtxKeyDeadLetterTask))
+		}
+		keys = append(keys, e.contextKeys(false)...)
+		for _, ancestor := range ancestors(e, upstream) {
+			keys = append(keys, ancestor.contextKeys(true)...)
+		}
+
+		for _, reference := range contextReferences(e.node) {
+			if !slices.ContainsFunc(keys, func(key string) bool { return matchKey(key, reference.key) }) {
+				v.add(reference.line, "task %s reads context key %s, which no upstream task sets", e, reference.key)
+			}
+		}
+	}
+
+}
+
+// runs reports whether a task is part of the pipeline that runs
+func (v *validation) runs(e *entry) bool {
+
+	p := v.pipeline
+	if p.DAG == nil {
+		return true
+	}
+
+	return p.DAG.taskNames()[e.name] || (p.DeadLetter != nil && p.DeadLetter.taskNames()[e.name])
+
+}
+
+// sorted returns the problems ordered by line
+func (v *validation) sorted() []Problem {
+
+	slices.SortStableFunc(v.problems, func(a, b Problem) int {
+		return cmp.Compare(a.Line, b.Line)
+	})
+
+	return v.problems
+
+}
+
+func (v *validation) add(line int, format string, args ...any) {
+	v.problems = append(v.problems, Problem{Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+// addError adds an error at line, or at the lines yaml reports in it
+func (v *validation) addError(line int, prefix string, err error) {
+
+	messages := []string{err.Error()}
+	var typeError *yaml.TypeError
+	if errors.As(err, &typeError) {
+		messages = typeError.Errors
+	}
+
+	for _, message := range messages {
+		problemLine := line
+		if match := yamlErrorLine.FindStringSubmatch(message); match != nil {
+			problemLine, _ = strconv.Atoi(match[1])
+			message = match[2]
+		}
+		v.add(problemLine, "%s%s", prefix, message)
+	}
+
+}
+
+// line returns the line of the first top-level field set among keys
+func (v *validation) line(keys ...string) int {
+
+	for _, key := range keys {
+		if node, found := v.sections[key]; found {
+			return node.Line
+		}
+	}
+
+	return 0
+
+}
+
+// String names the task, or its type when it has no name
+func (e *entry) String() string {
+
+	if e.name == `` {
+		return fmt.Sprintf("<unnamed %s>", e.kind)
+	}
+
+	return e.name
+
+}
+
+// contextKeys returns the keys the task sets on the records it sends; those of
+// its context field are only seen downstream
+func (e *entry) contextKeys(downstream bool) []string {
+
+	var keys []string
+
+	if setter, ok := e.task.(task.ContextSetter); ok {
+		keys = append(keys, setter.ContextKeys()...)
+	}
+
+	if context := mappingValue(e.node, `context`); downstream && context != nil && context.Kind == yaml.MappingNode {
+		for i := 0; i < len(context.Content); i += 2 {
+			keys = append(keys, context.Content[i].Value)
+		}
+	}
+
+	return keys
+
+}
+
+type contextReference struct {
+	key  string
+	line int
+}
+
+// contextReferences returns the {{ context }} keys in the values of a node
+func contextReferences(n *yaml.Node) []contextReference {
+
+	var references []contextReference
+
+	var walk func(*yaml.Node)
+	walk = func(n *yaml.Node) {
+		if n.Kind == yaml.ScalarNode {
+			for _, key := range config.ContextKeys(n.Value) {
+				references = append(references, contextReference{key: key, line: n.Line})
+			}
+		}
+		for _, child := range n.Content {
+			walk(child)
+		}
+	}
+	walk(n)
+
+	return references
+
+}
+
+// matchKey reports whether key, which may end with a * wildcard, matches name
+func matchKey(key, name string) bool {
+
+	if prefix, found := strings.CutSuffix(key, `*`); found {
+		return strings.HasPrefix(name, prefix)
+	}
+
+	return key == name
+
+}
+
+// ancestors returns every task upstream of e
+func ancestors(e *entry, upstream map[*entry][]*entry) []*entry {
+
+	seen := map[*entry]bool{e: true}
+	queue := slices.Clone(upstream[e])
+	var result []*entry
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if seen[current] {
+			continue
+		}
+		seen[current] = true
+		result = append(result, current)
+		queue = append(queue, upstream[current]...)
+	}
+
+	return result
+
+}
+
+func describePosition(position task.Position) string {
+
+	var names []string
+	if position&task.PositionFirst != 0 {
+		names = append(names, `first`)
+	}
+	if position&task.PositionMiddle != 0 {
+		names = append(names, `in the middle`)
+	}
+	if position&task.PositionLast != 0 {
+		names = append(names, `last`)
+	}
+
+	return strings.Join(names, ` or `)
+
+}
+
+func describeTag(fieldError validator.FieldError) string {
+
+	switch fieldError.Tag() {
+	case `required`:
+		return `is required`
+	case `oneof`:
+		return fmt.Sprintf("must be one of: %s", fieldError.Param())
+	}
+
+	if fieldError.Param() != `` {
+		return fmt.Sprintf("does not satisfy %s=%s", fieldError.Tag(), fieldError.Param())
+	}
+
+	return fmt.Sprintf("does not satisfy %s", fieldError.Tag())
+
+}
+
+func newConfigValidator() *validator.Validate {
+
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get(`yaml`), `,`)
+		if name == `-` {
+			return ``
+		}
+		return name
+	})
+
+	return v
+
+}
+
+// fieldPath splits a validator namespace into yaml keys, dropping the struct
+// name and the inline structs that have none
+func fieldPath(namespace string) []string {
+
+	var path []string
+	for _, part := range strings.Split(namespace, `.`)[1:] {
+		name, index, _ := strings.Cut(part, `[`)
+		if name != `` {
+			path = append(path, name)
+		}
+		if index != `` {
+			path = append(path, strings.TrimSuffix(index, `]`))
+		}
+	}
+
+	return path
+
+}
+
+// pathLine returns the line of the deepest node of path found under n
+func pathLine(n *yaml.Node, path []string) int {
+
+	line := n.Line
+	for _, key := range path {
+		var next *yaml.Node
+		switch n.Kind {
+		case yaml.MappingNode:
+			next = mappingValue(n, key)
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(key); err == nil && i < len(n.Content) {
+				next = n.Content[i]
+			}
+		}
+		if next == nil {
+			continue
+		}
+		n, line = next, next.Line
+	}
+
+	return line
+
+}
+
+// valueLine returns the line of the value of key in a mapping, or of the mapping
+func valueLine(n *yaml.Node, key string) int {
+
+	if value := mappingValue(n, key); value != nil {
+		return value.Line
+	}
+
+	return n.Line
+
+}
+
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+
+	return nil
+
+}
+
+// yamlFields returns the fields of a struct by yaml key, following inline
+// structs; it returns nil when any key is accepted, as with an inline map
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fields := make(map[string]reflect.StructField)
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get(`yaml`), `,`)
+		if name == `-` {
+			continue
+		}
+		if strings.Contains(options, `inline`) {
+			inline := yamlFields(field.Type)
+			if inline == nil {
+				return nil
+			}
+			for key, inlineField := range inline {
+				inlineField.Index = append([]int{i}, inlineField.Index...)
+				fields[key] = inlineField
+			}
+			continue
+		}
+		if name == `` {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field
+	}
+
+	return fields
+
+}
+
+// decodesItself reports whether a task implements its own yaml decoding, in
+// which case its fields cannot be told from its struct
+func decodesItself(t task.Task) bool {
+
+	switch t.(type) {
+	case yaml.Unmarshaler, interface{ UnmarshalYAML(func(any) error) error }:
+		return true
+	}
+
+	return false
+
+}
+
+func sortedNames(names map[string]bool) []string {
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	slices.Sort(sorted)
+
+	return sorted
+
+}
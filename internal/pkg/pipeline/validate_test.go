@@ -0,0 +1,219 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/patterninc/caterpillar/internal/pkg/config"
+)
+
+// Test that Validate reports configuration mistakes at their lines
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected []Problem
+	}{
+		{
+			name: "Valid pipeline",
+			config: `
+tasks:
+  - name: read
+    type: file
+    path: names.txt
+    context:
+      id: .id
+  - name: fetch
+    type: http
+    endpoint: https://example.com/{{ context "id" }}
+    headers:
+      Authorization: '{{ secret "/api/token" }}'
+  - name: write
+    type: file
+    path: out/{{ context "CATERPILLAR_FILE_NAME_WRITE" }}
+`,
+		},
+		{
+			name: "Unknown fields and types",
+			config: `
+channel: 10
+tasks:
+  - name: read
+    type: file
+    paht: names.txt
+  - name: parse
+    type: yaml
+  - name: echo
+    type: echo
+    task_concurrency: many
+`,
+			expected: []Problem{
+				{Line: 2, Message: "unknown field channel"},
+				{Line: 6, Message: "task read: unknown field paht"},
+				{Line: 8, Message: "task parse: task type is not supported: yaml"},
+				{Line: 11, Message: "task echo: cannot unmarshal !!str `many` into int"},
+			},
+		},
+		{
+			name: "Invalid field value",
+			config: `
+tasks:
+  - name: read
+    type: file
+    path: names.txt
+  - name: totals
+    type: aggregate
+    reducers:
+      total:
+        op: median
+  - name: echo
+    type: echo
+`,
+			expected: []Problem{
+				{Line: 10, Message: "task totals: reducers.total.op must be one of: count sum min max avg collect first last"},
+			},
+		},
+		{
+			name: "Dag references",
+			config: `
+tasks:
+  - name: read
+    type: file
+    path: names.txt
+  - name: echo
+    type: echo
+  - name: spare
+    type: echo
+dag: read >> [echo, missing]
+`,
+			expected: []Problem{
+				{Line: 8, Message: "task spare is not in the dag and never runs"},
+				{Line: 10, Message: "dag: task not found: missing"},
+			},
+		},
+		{
+			name: "Route target heading no branch",
+			config: `
+tasks:
+  - name: read
+    type: file
+    path: names.txt
+  - name: by_type
+    type: route
+    routes:
+      - when: .a
+        to: b
+  - name: a
+    type: echo
+  - name: b
+    type: echo
+  - name: c
+    type: echo
+dag: read >> by_type >> [a >> b, c]
+`,
+			expected: []Problem{
+				{Line: 17, Message: "task by_type routes records to b, which heads no branch of the group after it"},
+			},
+		},
+		{
+			name: "Side input ending no branch before the task",
+			config: `
+tasks:
+  - name: read_languages
+    type: file
+    path: languages.json
+  - name: read_people
+    type: file
+    path: people.json
+  - name: greet
+    type: enrich
+    side_input: read_languages
+    key: .language
+    table_key: .language
+  - name: parse
+    type: echo
+  - name: echo
+    type: echo
+dag: '[read_languages >> parse, read_people] >> greet >> echo'
+`,
+			expected: []Problem{
+				{Line: 18, Message: "task greet reads side input read_languages, which ends no branch of the group before it"},
+			},
+		},
+		{
+			name: "Sources and sinks out of place",
+			config: `
+tasks:
+  - name: totals
+    type: aggregate
+    reducers:
+      count:
+        op: count
+  - name: notify
+    type: sns
+    topic_arn: arn:aws:sns:us-west-2:123456789012:topic
+  - name: echo
+    type: echo
+`,
+			expected: []Problem{
+				{Line: 3, Message: "task totals (aggregate) cannot be first; it can only be in the middle"},
+				{Line: 8, Message: "task notify (sns) cannot be in the middle; it can only be last"},
+			},
+		},
+		{
+			name: "Context keys set by no upstream task",
+			config: `
+tasks:
+  - name: read
+    type: file
+    path: names.txt
+  - name: fetch
+    type: http
+    endpoint: https://example.com/{{ context "id" }}
+    context:
+      id: .id
+  - name: write
+    type: file
+    path: out/{{ context "id" }}/{{ context "http-header-Etag" }}/{{ context "page" }}
+`,
+			expected: []Problem{
+				{Line: 8, Message: "task fetch reads context key id, which no upstream task sets"},
+				{Line: 13, Message: "task write reads context key page, which no upstream task sets"},
+			},
+		},
+		{
+			name: "Context keys in a dead_letter branch",
+			config: `
+tasks:
+  - name: read
+    type: file
+    path: names.txt
+  - name: parse
+    type: jq
+    path: .
+    on_error: dead_letter
+  - name: echo
+    type: echo
+  - name: failed
+    type: file
+    path: failed/{{ context "CATERPILLAR_DEAD_LETTER_TASK" }}.txt
+dag: read >> parse >> echo
+dead_letter: failed
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), `pipeline.yaml`)
+			assert.NoError(t, os.WriteFile(path, []byte(tt.config), 0o644))
+
+			content, err := config.Render(path, true)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, Validate(content))
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"sync"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+)
+
+// Task traces the records of a single task; it implements task.Observer
+type Task struct {
+	name    string
+	tracing *Tracing
+
+	// the span of the record each worker is on, keyed by the worker's input channel
+	spans map[<-chan *record.Record]trace.Span
+	sync.Mutex
+}
+
+// Waiting ends the span of the record the worker was on, so the time it then
+// waits on an idle input is not part of it
+func (t *Task) Waiting(input <-chan *record.Record) {
+
+	t.Lock()
+	defer t.Unlock()
+
+	if span, found := t.spans[input]; found {
+		span.End()
+		delete(t.spans, input)
+	}
+
+}
+
+// Received starts the span of r
+func (t *Task) Received(input <-chan *record.Record, r *record.Record) {
+
+	if r == nil {
+		return
+	}
+
+	span := t.tracing.start(t.name, r)
+
+	t.Lock()
+	t.spans[input] = span
+	t.Unlock()
+
+}
+
+// Sent starts a trace for a record the task made without one, e.g. the records
+// of a source; records made from another one carry its span already
+func (t *Task) Sent(r *record.Record) {
+
+	if _, found := r.GetContextValue(traceParent); found {
+		return
+	}
+
+	t.tracing.start(t.name, r).End()
+
+}
+
+// Failed records the error on the span of r
+func (t *Task) Failed(r *record.Record, err error) {
+
+	if r == nil {
+		return
+	}
+
+	spanID := trace.SpanContextFromContext(recordContext(r)).SpanID()
+
+	t.Lock()
+	defer t.Unlock()
+
+	for _, span := range t.spans {
+		if span.SpanContext().SpanID() == spanID {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return
+		}
+	}
+
+}
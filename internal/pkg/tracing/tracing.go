@@ -0,0 +1,149 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+)
+
+const (
+	exporterOTLP       = `otlp`
+	exporterStdout     = `stdout`
+	defaultServiceName = `caterpillar`
+	tracerName         = `github.com/patterninc/caterpillar`
+	shutdownTimeout    = 5 * time.Second
+	traceParent        = `traceparent`
+)
+
+// the trace context of a record is kept in its context as W3C traceparent
+var propagator = propagation.TraceContext{}
+
+// Tracing exports a span per task and record, over OTLP or to stdout as JSON.
+// Every method but Init is safe to call on a nil *Tracing, which traces nothing.
+type Tracing struct {
+	Exporter    string `yaml:"exporter,omitempty" json:"exporter,omitempty"`
+	Endpoint    string `yaml:"endpoint,omitempty" json:"endpoint,omitempty"`
+	Insecure    bool   `yaml:"insecure,omitempty" json:"insecure,omitempty"`
+	ServiceName string `yaml:"service_name,omitempty" json:"service_name,omitempty"`
+
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+// Check validates the configuration without creating the exporter
+func (t *Tracing) Check() error {
+
+	switch t.Exporter {
+	case ``, exporterOTLP, exporterStdout:
+		return nil
+	default:
+		return fmt.Errorf("unknown tracing exporter: %s", t.Exporter)
+	}
+
+}
+
+// Init creates the exporter; it is called once after unmarshaling
+func (t *Tracing) Init() error {
+
+	if err := t.Check(); err != nil {
+		return err
+	}
+	if t.Exporter == `` {
+		t.Exporter = exporterOTLP
+	}
+	if t.ServiceName == `` {
+		t.ServiceName = defaultServiceName
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	if t.Exporter == exporterStdout {
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	} else {
+		var options []otlptracehttp.Option
+		if t.Endpoint != `` {
+			options = append(options, otlptracehttp.WithEndpoint(t.Endpoint))
+		}
+		if t.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(context.Background(), options...)
+	}
+	if err != nil {
+		return fmt.Errorf("tracing: %w", err)
+	}
+
+	t.provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String(`service.name`, t.ServiceName))),
+	)
+	t.tracer = t.provider.Tracer(tracerName)
+
+	return nil
+
+}
+
+// Stop exports the spans still buffered; call it once the pipeline has run
+func (t *Tracing) Stop() error {
+
+	if t == nil || t.provider == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	return t.provider.Shutdown(ctx)
+
+}
+
+// Task returns the observer for the named task
+func (t *Tracing) Task(name string) *Task {
+
+	if t == nil {
+		return nil
+	}
+
+	return &Task{
+		name:    name,
+		tracing: t,
+		spans:   make(map[<-chan *record.Record]trace.Span),
+	}
+
+}
+
+// start starts the span of the task for r, as a child of the span r carries, if
+// any, and sets it on r as the span of the tasks downstream
+func (t *Tracing) start(name string, r *record.Record) trace.Span {
+
+	ctx, span := t.tracer.Start(recordContext(r), name, trace.WithAttributes(
+		attribute.String(`caterpillar.task`, name),
+		attribute.Int(`caterpillar.record.id`, r.ID),
+		attribute.String(`caterpillar.record.origin`, r.Origin),
+	))
+
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	for key, value := range carrier {
+		r.SetContextValue(key, value)
+	}
+
+	return span
+
+}
+
+// recordContext returns a context holding the span r carries, if any
+func recordContext(r *record.Record) context.Context {
+	return propagator.Extract(context.Background(), propagation.MapCarrier(r.Context))
+}
@@ -0,0 +1,191 @@
+// Package caterpillar runs caterpillar pipelines inside a Go program. A pipeline
+// is loaded from the same configuration the command line reads, can use task
+// types the program registers, and exchanges records with it through memory
+// sources and collect sinks.
+//
+//	p, err := caterpillar.Load(config)
+//	if err != nil {
+//		return err
+//	}
+//	if err := p.Feed(`requests`, &caterpillar.Record{Data: data}); err != nil {
+//		return err
+//	}
+//	if err := p.Run(ctx); err != nil {
+//		return err
+//	}
+//	records, err := p.Records(`results`)
+package caterpillar
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/patterninc/caterpillar/internal/pkg/config"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/record"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task"
+	"github.com/patterninc/caterpillar/internal/pkg/pipeline/task/exec_plugin"
+)
+
+type (
+	// Record is the unit of data passed from task to task
+	Record = record.Record
+
+	// Metadata holds the context values of a record by key; set them with
+	// Record.SetContextValue, which leaves the records sharing them unchanged
+	Metadata = record.Metadata
+
+	// Task is a pipeline stage; custom tasks embed Base and implement Run
+	Task = task.Task
+
+	// Base holds the fields every task is configured with: name, type,
+	// fail_on_error, concurrency, etc. Embed it inline:
+	//
+	//	type upper struct {
+	//		caterpillar.Base `yaml:",inline" json:",inline"`
+	//	}
+	Base = task.Base
+
+	// Placed is implemented by tasks that can only run at some positions of a pipeline
+	Placed   = task.Placed
+	Position = task.Position
+
+	// Feeder is implemented by sources Go code can hand records to, e.g. memory
+	Feeder = task.Feeder
+
+	// Collector is implemented by sinks keeping the records they read, e.g. collect
+	Collector = task.Collector
+
+	// Plugin is a task type implemented by an executable; register its New to
+	// make it available to every pipeline, not only those declaring it
+	Plugin = exec_plugin.Plugin
+)
+
+const (
+	PositionFirst  = task.PositionFirst
+	PositionMiddle = task.PositionMiddle
+	PositionLast   = task.PositionLast
+)
+
+var (
+	ErrNilInput  = task.ErrNilInput
+	ErrNilOutput = task.ErrNilOutput
+)
+
+// Register adds a task type that configurations can use. Call it before loading
+// the pipelines that use the type, e.g. from an init function; built-in types
+// and types registered already cannot be replaced.
+func Register(taskType string, newTask func() (Task, error)) error {
+	return pipeline.RegisterTask(taskType, newTask)
+}
+
+// Pipeline is a loaded pipeline. It runs once; load it again to run it again.
+type Pipeline struct {
+	pipeline *pipeline.Pipeline
+	ran      atomic.Bool
+}
+
+// Load loads a pipeline from its YAML configuration. Templates are executed as
+// the command line does: env, secret, macro and context all work.
+func Load(content []byte) (*Pipeline, error) {
+
+	rendered, err := config.RenderContent(content, false)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &pipeline.Pipeline{}
+	if err := yaml.Unmarshal(rendered, p); err != nil {
+		return nil, err
+	}
+
+	return &Pipeline{pipeline: p}, nil
+
+}
+
+// LoadFile loads a pipeline from a configuration file
+func LoadFile(file string) (*Pipeline, error) {
+
+	p := &pipeline.Pipeline{}
+	if err := config.Load(file, p); err != nil {
+		return nil, err
+	}
+
+	return &Pipeline{pipeline: p}, nil
+
+}
+
+// LoadConfig loads a pipeline from a value holding its configuration, e.g. a
+// map or a struct with yaml tags, marshaled to YAML and loaded as Load does
+func LoadConfig(value any) (*Pipeline, error) {
+
+	content, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return Load(content)
+
+}
+
+// Run executes the pipeline until every task has finished. Cancelling ctx stops
+// the sources and lets the records in flight drain, as on SIGINT.
+func (p *Pipeline) Run(ctx context.Context) error {
+
+	if !p.ran.CompareAndSwap(false, true) {
+		return fmt.Errorf("the pipeline has run already")
+	}
+
+	return p.pipeline.Run(ctx)
+
+}
+
+// Feed hands records to a source task, e.g. memory, to send once the pipeline
+// runs; feed it before calling Run
+func (p *Pipeline) Feed(taskName string, records ...*Record) error {
+
+	t, found := p.pipeline.Task(taskName)
+	if !found {
+		return fmt.Errorf("task not found: %s", taskName)
+	}
+
+	feeder, ok := t.(Feeder)
+	if !ok {
+		return fmt.Errorf("task %s (%s) cannot be fed records", taskName, t.GetType())
+	}
+	feeder.Feed(records...)
+
+	return nil
+
+}
+
+// Records returns the records a sink task, e.g. collect, kept while the pipeline ran
+func (p *Pipeline) Records(taskName string) ([]*Record, error) {
+
+	t, found := p.pipeline.Task(taskName)
+	if !found {
+		return nil, fmt.Errorf("task not found: %s", taskName)
+	}
+
+	collector, ok := t.(Collector)
+	if !ok {
+		return nil, fmt.Errorf("task %s (%s) does not keep records", taskName, t.GetType())
+	}
+
+	return collector.Records(), nil
+
+}
+
+// Task returns the task with the given name
+func (p *Pipeline) Task(name string) (Task, bool) {
+	return p.pipeline.Task(name)
+}
+
+// Logger returns the logger configured by log_level and log_format
+func (p *Pipeline) Logger() *slog.Logger {
+	return p.pipeline.Logger()
+}
@@ -0,0 +1,96 @@
+package caterpillar
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type upper struct {
+	Base `yaml:",inline" json:",inline"`
+}
+
+func (u *upper) Run(_ context.Context, input <-chan *Record, output chan<- *Record) error {
+
+	if input == nil {
+		return ErrNilInput
+	}
+
+	for {
+		r, ok := u.GetRecord(input)
+		if !ok {
+			break
+		}
+		r.Data = bytes.ToUpper(r.Data)
+		u.SendRecord(r, output)
+	}
+
+	return nil
+
+}
+
+func init() {
+	if err := Register(`upper`, func() (Task, error) { return &upper{}, nil }); err != nil {
+		panic(err)
+	}
+}
+
+// Test that a pipeline with a registered task type runs on records fed from Go
+func TestLoadRunsRegisteredTask(t *testing.T) {
+	p, err := Load([]byte(`
+tasks:
+  - name: source
+    type: memory
+    records:
+      - data: ada
+  - name: shout
+    type: upper
+  - name: results
+    type: collect
+`))
+	assert.NoError(t, err)
+
+	fed := &Record{Data: []byte(`grace`)}
+	assert.NoError(t, p.Feed(`source`, fed))
+	assert.NoError(t, p.Run(context.Background()))
+
+	records, err := p.Records(`results`)
+	assert.NoError(t, err)
+	var data []string
+	for _, r := range records {
+		data = append(data, string(r.Data))
+	}
+	assert.Equal(t, []string{`ADA`, `GRACE`}, data)
+
+	assert.ErrorContains(t, p.Run(context.Background()), "the pipeline has run already")
+	assert.ErrorContains(t, p.Feed(`results`), "task results (collect) cannot be fed records")
+	_, err = p.Records(`missing`)
+	assert.ErrorContains(t, err, "task not found: missing")
+}
+
+// Test that a pipeline loads from a value as it does from its YAML
+func TestLoadConfig(t *testing.T) {
+	type config struct {
+		Tasks []map[string]any `yaml:"tasks"`
+	}
+	p, err := LoadConfig(&config{Tasks: []map[string]any{
+		{`name`: `source`, `type`: `values`, `values`: []any{`a`, `b`}},
+		{`name`: `results`, `type`: `collect`},
+	}})
+	assert.NoError(t, err)
+	assert.NoError(t, p.Run(context.Background()))
+
+	records, err := p.Records(`results`)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+}
+
+// Test that task types cannot be registered twice or replace built-in ones
+func TestRegister(t *testing.T) {
+	newTask := func() (Task, error) { return &upper{}, nil }
+	assert.ErrorContains(t, Register(`upper`, newTask), "task type is already supported: upper")
+	assert.ErrorContains(t, Register(`jq`, newTask), "task type is already supported: jq")
+	assert.Error(t, Register(``, newTask))
+}
@@ -0,0 +1,20 @@
+#!/usr/bin/env python3
+# A caterpillar plugin: adds the length of a field of each JSON record to it, and
+# sets the length as the context key "length". The field is read from the
+# configuration of the task.
+import json
+import os
+import sys
+
+config = json.loads(os.environ["CATERPILLAR_TASK_CONFIG"])
+field = config.get("field", "name")
+
+for line in sys.stdin:
+    message = json.loads(line)
+    item = json.loads(message["data"])
+    if field not in item:
+        reply = {"error": f"record has no {field}"}
+    else:
+        item["length"] = len(item[field])
+        reply = {"records": [{"data": json.dumps(item), "context": {"length": str(item["length"])}}]}
+    print(json.dumps(reply), flush=True)